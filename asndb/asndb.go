@@ -0,0 +1,216 @@
+// Package asndb 从本地 ip2asn TSV 或 MRT RIB 转储文件加载地址到源ASN的映射，用于离线标注路由节点
+package asndb
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/oneclickvirt/backtrace/iptrie"
+	"github.com/oneclickvirt/backtrace/model"
+)
+
+// Record 地址的查询结果
+type Record struct {
+	Prefix netip.Prefix
+	ASN    uint32
+	Name   string
+}
+
+// DB 离线的地址到源ASN数据库，加载完成后可并发查询
+type DB struct {
+	table iptrie.Table[uint32]
+	names map[uint32]string
+}
+
+// New 返回空数据库
+func New() *DB {
+	return &DB{names: make(map[uint32]string)}
+}
+
+// Open 打开 ip2asn TSV 或 MRT TABLE_DUMP_V2 文件，支持 gzip 和 bzip2 压缩，格式根据内容自动识别
+func Open(path string) (*DB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	db := New()
+	if err := db.Load(f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return db, nil
+}
+
+// Load 从 r 中读取 ip2asn TSV 或 MRT 数据并合并到数据库
+func (db *DB) Load(r io.Reader) error {
+	br, err := decompress(r)
+	if err != nil {
+		return err
+	}
+	head, _ := br.Peek(12)
+	if isMRT(head) {
+		return db.LoadMRT(br)
+	}
+	return db.LoadIP2ASN(br)
+}
+
+// decompress 根据魔数透明解压 gzip 或 bzip2 数据
+func decompress(r io.Reader) (*bufio.Reader, error) {
+	br := bufio.NewReaderSize(r, 1<<16)
+	magic, _ := br.Peek(3)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return bufio.NewReaderSize(zr, 1<<16), nil
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return bufio.NewReaderSize(bzip2.NewReader(br), 1<<16), nil
+	}
+	return br, nil
+}
+
+// LoadIP2ASN 读取 iptoasn.com 格式的TSV数据：
+// range_start range_end AS_number country_code AS_description，ASN为0的未路由地址段被忽略
+func (db *DB) LoadIP2ASN(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+		if len(fields) < 3 {
+			return fmt.Errorf("line %d: expected at least 3 tab separated fields", line)
+		}
+		start, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		end, err := netip.ParseAddr(fields[1])
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		asn, err := strconv.ParseUint(strings.TrimPrefix(fields[2], "AS"), 10, 32)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid ASN %q", line, fields[2])
+		}
+		if asn == 0 {
+			continue
+		}
+		if len(fields) >= 5 && fields[4] != "" && fields[4] != "Not routed" {
+			db.names[uint32(asn)] = fields[4]
+		}
+		for _, prefix := range rangeToPrefixes(start.Unmap(), end.Unmap()) {
+			db.table.Insert(prefix, uint32(asn))
+		}
+	}
+	return scanner.Err()
+}
+
+// LoadNames 读取ASN名称列表，每行为 "ASN 名称"，ASN可带 AS 前缀（兼容 RIPE asnames.txt 格式），
+// 已有的名称会被覆盖
+func (db *DB) LoadNames(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		asnText, name, _ := strings.Cut(text, " ")
+		asnText, _, _ = strings.Cut(asnText, "\t")
+		asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(asnText), "AS"), 10, 32)
+		if err != nil {
+			continue
+		}
+		db.names[uint32(asn)] = strings.TrimSpace(name)
+	}
+	return scanner.Err()
+}
+
+// Lookup 返回覆盖 addr 的最长前缀所属的源ASN及名称
+func (db *DB) Lookup(addr netip.Addr) (Record, bool) {
+	if db == nil {
+		return Record{}, false
+	}
+	prefix, asn, ok := db.table.LookupPrefix(addr)
+	if !ok {
+		return Record{}, false
+	}
+	return Record{Prefix: prefix, ASN: asn, Name: db.Name(asn)}, true
+}
+
+// Name 返回ASN的名称，数据中没有时使用内置的知名ASN名称
+func (db *DB) Name(asn uint32) string {
+	if name, ok := db.names[asn]; ok {
+		return name
+	}
+	key := strconv.FormatUint(uint64(asn), 10)
+	for _, m := range []map[string]string{model.Tier1Global, model.Tier1Regional, model.Tier2, model.ContentProviders, model.IXPS} {
+		if name, ok := m[key]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// Len 返回数据库中的前缀数量
+func (db *DB) Len() int {
+	return db.table.Len()
+}
+
+// rangeToPrefixes 将闭区间 [start, end] 拆分为最少的CIDR前缀
+func rangeToPrefixes(start, end netip.Addr) []netip.Prefix {
+	if !start.IsValid() || !end.IsValid() || start.Is4() != end.Is4() || end.Less(start) {
+		return nil
+	}
+	var prefixes []netip.Prefix
+	for {
+		bits := start.BitLen()
+		for bits > 0 {
+			p := netip.PrefixFrom(start, bits-1).Masked()
+			if p.Addr() != start || end.Less(lastAddr(p)) {
+				break
+			}
+			bits--
+		}
+		p := netip.PrefixFrom(start, bits)
+		prefixes = append(prefixes, p)
+		last := lastAddr(p)
+		if last == end || !last.Next().IsValid() {
+			return prefixes
+		}
+		start = last.Next()
+	}
+}
+
+// lastAddr 返回前缀中的最后一个地址
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Masked().Addr().AsSlice()
+	bits := p.Bits()
+	for i := range b {
+		switch {
+		case bits >= 8:
+			bits -= 8
+		case bits > 0:
+			b[i] |= 0xff >> uint(bits)
+			bits = 0
+		default:
+			b[i] = 0xff
+		}
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
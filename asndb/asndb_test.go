@@ -0,0 +1,133 @@
+package asndb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+const sampleTSV = "1.0.0.0\t1.0.0.255\t13335\tUS\tCLOUDFLARENET\n" +
+	"1.0.1.0\t1.0.3.255\t0\tNone\tNot routed\n" +
+	"59.43.0.0\t59.43.255.255\t4809\tCN\tCHINATELECOM-CORE-WAN-CN2\n" +
+	"202.97.0.0\t202.97.127.255\t4134\tCN\tCHINANET-BACKBONE\n" +
+	"2400:9380:9001::\t2400:9380:9001:ffff:ffff:ffff:ffff:ffff\t4809\tCN\tCHINATELECOM-CORE-WAN-CN2\n"
+
+func TestLoadIP2ASN(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(sampleTSV))
+	zw.Close()
+	db := New()
+	if err := db.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		ip   string
+		asn  uint32
+		name string
+	}{
+		{"1.0.0.1", 13335, "CLOUDFLARENET"},
+		{"1.0.2.1", 0, ""},
+		{"59.43.182.1", 4809, "CHINATELECOM-CORE-WAN-CN2"},
+		{"202.97.100.1", 4134, "CHINANET-BACKBONE"},
+		{"202.97.200.1", 0, ""},
+		{"2400:9380:9001::1", 4809, "CHINATELECOM-CORE-WAN-CN2"},
+	}
+	for _, c := range cases {
+		rec, ok := db.Lookup(netip.MustParseAddr(c.ip))
+		if rec.ASN != c.asn || rec.Name != c.name || ok != (c.asn != 0) {
+			t.Errorf("Lookup(%s) = %+v, %v; want AS%d %q", c.ip, rec, ok, c.asn, c.name)
+		}
+	}
+}
+
+func TestRangeToPrefixes(t *testing.T) {
+	cases := map[[2]string]string{
+		{"10.0.0.0", "10.0.0.255"}:     "10.0.0.0/24",
+		{"10.0.0.1", "10.0.0.6"}:       "10.0.0.1/32 10.0.0.2/31 10.0.0.4/31 10.0.0.6/32",
+		{"10.0.4.0", "10.0.7.255"}:     "10.0.4.0/22",
+		{"0.0.0.0", "255.255.255.255"}: "0.0.0.0/0",
+		{"2001:db8::", "2001:db8::1"}:  "2001:db8::/127",
+	}
+	for r, want := range cases {
+		var got []string
+		for _, p := range rangeToPrefixes(netip.MustParseAddr(r[0]), netip.MustParseAddr(r[1])) {
+			got = append(got, p.String())
+		}
+		if strings.Join(got, " ") != want {
+			t.Errorf("rangeToPrefixes(%s, %s) = %v, want %s", r[0], r[1], got, want)
+		}
+	}
+}
+
+// mrtRecord 构造一条 MRT 记录
+func mrtRecord(subtype uint16, body []byte) []byte {
+	b := make([]byte, 12, 12+len(body))
+	binary.BigEndian.PutUint16(b[4:6], mrtTableDumpV2)
+	binary.BigEndian.PutUint16(b[6:8], subtype)
+	binary.BigEndian.PutUint32(b[8:12], uint32(len(body)))
+	return append(b, body...)
+}
+
+// ribEntry 构造只包含 AS_PATH 属性的RIB记录
+func ribEntry(prefix netip.Prefix, paths ...[]uint32) []byte {
+	var b []byte
+	b = append(b, 0, 0, 0, 1, byte(prefix.Bits()))
+	b = append(b, prefix.Addr().AsSlice()[:(prefix.Bits()+7)/8]...)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(paths)))
+	for _, path := range paths {
+		seg := []byte{asSequence, byte(len(path))}
+		for _, asn := range path {
+			seg = binary.BigEndian.AppendUint32(seg, asn)
+		}
+		// ORIGIN 属性 + AS_PATH 属性
+		attrs := []byte{0x40, 1, 1, 0, 0x40, attrASPath, byte(len(seg))}
+		attrs = append(attrs, seg...)
+		b = append(b, 0, 0, 0, 0, 0, 0)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(attrs)))
+		b = append(b, attrs...)
+	}
+	return b
+}
+
+func TestLoadMRT(t *testing.T) {
+	var dump []byte
+	dump = append(dump, mrtRecord(subtypePeerIndexTable, []byte{1, 2, 3, 4, 0, 0, 0, 0})...)
+	dump = append(dump, mrtRecord(subtypeRIBIPv4Unicast, ribEntry(netip.MustParsePrefix("59.43.0.0/16"), []uint32{3356, 4134, 4809}, []uint32{6939, 4809}))...)
+	dump = append(dump, mrtRecord(subtypeRIBIPv4Unicast, ribEntry(netip.MustParsePrefix("59.43.64.0/18"), []uint32{174, 23764}))...)
+	dump = append(dump, mrtRecord(subtypeRIBIPv6Unicast, ribEntry(netip.MustParsePrefix("2400:9380::/32"), []uint32{6939, 4134}))...)
+	db := New()
+	if err := db.Load(bytes.NewReader(dump)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.LoadNames(strings.NewReader("4809 CHINATELECOM-CORE-WAN-CN2, CN\nAS4134 CHINANET-BACKBONE\n")); err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]uint32{
+		"59.43.1.1":      4809,
+		"59.43.100.1":    23764,
+		"2400:9380:1::1": 4134,
+		"8.8.8.8":        0,
+	}
+	for ip, want := range cases {
+		rec, _ := db.Lookup(netip.MustParseAddr(ip))
+		if rec.ASN != want {
+			t.Errorf("Lookup(%s) = AS%d, want AS%d", ip, rec.ASN, want)
+		}
+	}
+	if name := db.Name(4809); name != "CHINATELECOM-CORE-WAN-CN2, CN" {
+		t.Errorf("Name(4809) = %q", name)
+	}
+	if name := db.Name(3356); name != "Lumen" {
+		t.Errorf("Name(3356) = %q, want built-in name", name)
+	}
+	if db.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", db.Len())
+	}
+	if err := New().Load(bytes.NewReader(dump[:len(dump)-3])); err == nil {
+		t.Error("truncated dump loaded without error")
+	}
+}
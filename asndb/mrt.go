@@ -0,0 +1,169 @@
+package asndb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+)
+
+// MRT 类型和子类型，参见 RFC 6396 与 RFC 8050
+const (
+	mrtTableDumpV2 = 13
+
+	subtypePeerIndexTable        = 1
+	subtypeRIBIPv4Unicast        = 2
+	subtypeRIBIPv6Unicast        = 4
+	subtypeRIBIPv4UnicastAddPath = 8
+	subtypeRIBIPv6UnicastAddPath = 9
+
+	attrASPath     = 2
+	attrFlagExtLen = 0x10
+
+	asSet      = 1
+	asSequence = 2
+)
+
+var errMRTTruncated = errors.New("truncated MRT record")
+
+// isMRT 根据记录头判断数据是否为 TABLE_DUMP_V2 格式的MRT
+func isMRT(head []byte) bool {
+	if len(head) < 12 {
+		return false
+	}
+	typ := binary.BigEndian.Uint16(head[4:6])
+	subtype := binary.BigEndian.Uint16(head[6:8])
+	return typ == mrtTableDumpV2 && subtype >= subtypePeerIndexTable && subtype <= 10
+}
+
+// LoadMRT 读取 MRT TABLE_DUMP_V2 RIB 转储（如 RouteViews、RIPE RIS 的 bview/rib 文件），
+// 以每个前缀第一条有效路由的 AS_PATH 末尾ASN作为源ASN，其他类型的记录被忽略
+func (db *DB) LoadMRT(r io.Reader) error {
+	header := make([]byte, 12)
+	var body []byte
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("read MRT header: %w", err)
+		}
+		typ := binary.BigEndian.Uint16(header[4:6])
+		subtype := binary.BigEndian.Uint16(header[6:8])
+		length := binary.BigEndian.Uint32(header[8:12])
+		if length > 16<<20 {
+			return fmt.Errorf("MRT record too large: %d bytes", length)
+		}
+		if cap(body) < int(length) {
+			body = make([]byte, length)
+		}
+		body = body[:length]
+		if _, err := io.ReadFull(r, body); err != nil {
+			return fmt.Errorf("read MRT record: %w", err)
+		}
+		if typ != mrtTableDumpV2 {
+			continue
+		}
+		var err error
+		switch subtype {
+		case subtypeRIBIPv4Unicast:
+			err = db.parseRIB(body, false, false)
+		case subtypeRIBIPv6Unicast:
+			err = db.parseRIB(body, true, false)
+		case subtypeRIBIPv4UnicastAddPath:
+			err = db.parseRIB(body, false, true)
+		case subtypeRIBIPv6UnicastAddPath:
+			err = db.parseRIB(body, true, true)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// parseRIB 解析 RIB_IPV4_UNICAST/RIB_IPV6_UNICAST 记录
+func (db *DB) parseRIB(b []byte, ipv6, addPath bool) error {
+	// sequence number(4) + prefix length(1)
+	if len(b) < 5 {
+		return errMRTTruncated
+	}
+	bits := int(b[4])
+	b = b[5:]
+	n := (bits + 7) / 8
+	size := 4
+	if ipv6 {
+		size = 16
+	}
+	if bits > size*8 || len(b) < n+2 {
+		return errMRTTruncated
+	}
+	raw := make([]byte, size)
+	copy(raw, b[:n])
+	addr, _ := netip.AddrFromSlice(raw)
+	prefix := netip.PrefixFrom(addr, bits).Masked()
+	count := int(binary.BigEndian.Uint16(b[n : n+2]))
+	b = b[n+2:]
+	for i := 0; i < count; i++ {
+		// peer index(2) + originated time(4) [+ path identifier(4)] + attribute length(2)
+		skip := 6
+		if addPath {
+			skip += 4
+		}
+		if len(b) < skip+2 {
+			return errMRTTruncated
+		}
+		attrLen := int(binary.BigEndian.Uint16(b[skip : skip+2]))
+		b = b[skip+2:]
+		if len(b) < attrLen {
+			return errMRTTruncated
+		}
+		if origin, ok := originASN(b[:attrLen]); ok {
+			db.table.Insert(prefix, origin)
+			return nil
+		}
+		b = b[attrLen:]
+	}
+	return nil
+}
+
+// originASN 从BGP路径属性中取出 AS_PATH 的源ASN，TABLE_DUMP_V2 中的ASN均为4字节
+func originASN(attrs []byte) (uint32, bool) {
+	for len(attrs) >= 3 {
+		flags, typ := attrs[0], attrs[1]
+		var length, hdr int
+		if flags&attrFlagExtLen != 0 {
+			if len(attrs) < 4 {
+				return 0, false
+			}
+			length, hdr = int(binary.BigEndian.Uint16(attrs[2:4])), 4
+		} else {
+			length, hdr = int(attrs[2]), 3
+		}
+		if len(attrs) < hdr+length {
+			return 0, false
+		}
+		value := attrs[hdr : hdr+length]
+		attrs = attrs[hdr+length:]
+		if typ != attrASPath {
+			continue
+		}
+		var origin uint32
+		found := false
+		for len(value) >= 2 {
+			segType, segLen := value[0], int(value[1])
+			value = value[2:]
+			if len(value) < segLen*4 {
+				return 0, false
+			}
+			// 源ASN取最后一个 AS_SEQUENCE 的最后一个ASN，AS_SET 仅在没有序列时使用
+			if segLen > 0 && (segType == asSequence || (segType == asSet && !found)) {
+				origin = binary.BigEndian.Uint32(value[(segLen-1)*4:])
+				found = true
+			}
+			value = value[segLen*4:]
+		}
+		return origin, found
+	}
+	return 0, false
+}
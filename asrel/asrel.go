@@ -0,0 +1,222 @@
+// Package asrel 读取 CAIDA AS Relationships 数据集（serial-1 及 serial-2 格式），
+// 离线查询AS之间的提供者/客户及对等关系
+package asrel
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 数据集中的关系类型
+const (
+	ProviderToCustomer = -1 // <provider-as>|<customer-as>|-1
+	PeerToPeer         = 0  // <peer-as>|<peer-as>|0
+)
+
+// Graph AS关系图
+type Graph struct {
+	providers map[uint32][]uint32
+	customers map[uint32][]uint32
+	peers     map[uint32][]uint32
+	clique    map[uint32]bool // 数据集头部注释给出的Tier-1集合
+	links     int
+}
+
+// New 创建空的关系图
+func New() *Graph {
+	return &Graph{
+		providers: make(map[uint32][]uint32),
+		customers: make(map[uint32][]uint32),
+		peers:     make(map[uint32][]uint32),
+		clique:    make(map[uint32]bool),
+	}
+}
+
+// Open 打开数据集文件，支持 gzip 和 bzip2 压缩
+func Open(path string) (*Graph, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	g := New()
+	if err := g.Load(f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return g, nil
+}
+
+// Load 读取数据集，以 # 开头的行为注释，其中 "# input clique:" 或 "# inferred clique:" 给出Tier-1集合；
+// serial-2 的第4列（数据来源）被忽略
+func (g *Graph) Load(r io.Reader) error {
+	br, err := decompress(r)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(br)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, "#") {
+			g.parseComment(text)
+			continue
+		}
+		fields := strings.Split(text, "|")
+		if len(fields) < 3 {
+			return fmt.Errorf("line %d: expected at least 3 fields", line)
+		}
+		a, err := parseASN(fields[0])
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		b, err := parseASN(fields[1])
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		rel, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return fmt.Errorf("line %d: invalid relationship %q", line, fields[2])
+		}
+		if err := g.Add(a, b, rel); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// Add 添加一条关系，rel 为 ProviderToCustomer 时 a 为 b 的提供者
+func (g *Graph) Add(a, b uint32, rel int) error {
+	switch rel {
+	case ProviderToCustomer:
+		g.providers[b] = append(g.providers[b], a)
+		g.customers[a] = append(g.customers[a], b)
+	case PeerToPeer:
+		g.peers[a] = append(g.peers[a], b)
+		g.peers[b] = append(g.peers[b], a)
+	default:
+		return fmt.Errorf("unknown relationship %d", rel)
+	}
+	g.links++
+	return nil
+}
+
+// parseComment 记录注释中的Tier-1集合
+func (g *Graph) parseComment(text string) {
+	text = strings.TrimSpace(strings.TrimPrefix(text, "#"))
+	for _, prefix := range []string{"input clique:", "inferred clique:"} {
+		if list, ok := strings.CutPrefix(text, prefix); ok {
+			for _, f := range strings.Fields(list) {
+				if asn, err := parseASN(f); err == nil {
+					g.clique[asn] = true
+				}
+			}
+		}
+	}
+}
+
+// Providers 返回 asn 的提供者，按ASN升序排列
+func (g *Graph) Providers(asn uint32) []uint32 { return sorted(g.providers[asn]) }
+
+// Customers 返回 asn 的直接客户，按ASN升序排列
+func (g *Graph) Customers(asn uint32) []uint32 { return sorted(g.customers[asn]) }
+
+// Peers 返回与 asn 对等互联的AS，按ASN升序排列
+func (g *Graph) Peers(asn uint32) []uint32 { return sorted(g.peers[asn]) }
+
+// IsTier1 返回 asn 是否属于Tier-1集合：数据集给出集合时以其为准，
+// 否则将有客户但没有提供者的AS（无需购买转接）视为Tier-1
+func (g *Graph) IsTier1(asn uint32) bool {
+	if len(g.clique) > 0 {
+		return g.clique[asn]
+	}
+	return len(g.providers[asn]) == 0 && len(g.customers[asn]) > 0
+}
+
+// Ancestors 返回 asn 的提供者层级：第0层为直接提供者，第n层为第n-1层的提供者中未在更早层级出现的AS，
+// 每层按ASN升序排列
+func (g *Graph) Ancestors(asn uint32) [][]uint32 {
+	seen := map[uint32]bool{asn: true}
+	var levels [][]uint32
+	current := []uint32{asn}
+	for len(current) > 0 {
+		var next []uint32
+		for _, a := range current {
+			for _, p := range g.providers[a] {
+				if !seen[p] {
+					seen[p] = true
+					next = append(next, p)
+				}
+			}
+		}
+		if len(next) == 0 {
+			break
+		}
+		next = sorted(next)
+		levels = append(levels, next)
+		current = next
+	}
+	return levels
+}
+
+// CustomerCone 返回 asn 的客户锥大小：沿客户关系可达的AS数量，包含自身
+func (g *Graph) CustomerCone(asn uint32) int {
+	seen := map[uint32]bool{asn: true}
+	queue := []uint32{asn}
+	for len(queue) > 0 {
+		a := queue[0]
+		queue = queue[1:]
+		for _, c := range g.customers[a] {
+			if !seen[c] {
+				seen[c] = true
+				queue = append(queue, c)
+			}
+		}
+	}
+	return len(seen)
+}
+
+// Len 返回关系的数量
+func (g *Graph) Len() int { return g.links }
+
+func sorted(asns []uint32) []uint32 {
+	s := append([]uint32(nil), asns...)
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	return s
+}
+
+func parseASN(s string) (uint32, error) {
+	asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "AS"), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ASN %q", s)
+	}
+	return uint32(asn), nil
+}
+
+// decompress 根据魔数透明解压 gzip 或 bzip2 数据
+func decompress(r io.Reader) (*bufio.Reader, error) {
+	br := bufio.NewReaderSize(r, 1<<16)
+	magic, _ := br.Peek(3)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return bufio.NewReaderSize(zr, 1<<16), nil
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return bufio.NewReaderSize(bzip2.NewReader(br), 1<<16), nil
+	}
+	return br, nil
+}
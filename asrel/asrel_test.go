@@ -0,0 +1,72 @@
+package asrel
+
+import (
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const serial1 = `# source:topology|BGP|20261001|asrank
+# input clique: 174 1299 3356
+174|1299|0
+174|64500|-1
+6939|64500|-1
+1299|6939|-1
+`
+
+func TestLoad(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(serial1))
+	zw.Close()
+	for name, data := range map[string][]byte{"plain": []byte(serial1), "gzip": gz.Bytes()} {
+		g := New()
+		if err := g.Load(bytes.NewReader(data)); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if g.Len() != 4 {
+			t.Errorf("%s: %d links", name, g.Len())
+		}
+		if got := g.Providers(64500); !reflect.DeepEqual(got, []uint32{174, 6939}) {
+			t.Errorf("%s: providers of 64500 = %v", name, got)
+		}
+		if got := g.Customers(1299); !reflect.DeepEqual(got, []uint32{6939}) {
+			t.Errorf("%s: customers of 1299 = %v", name, got)
+		}
+		if got := g.Peers(1299); !reflect.DeepEqual(got, []uint32{174}) {
+			t.Errorf("%s: peers of 1299 = %v", name, got)
+		}
+	}
+	g := New()
+	if err := g.Load(strings.NewReader(serial1 + "64500|64501|-1\n")); err != nil {
+		t.Fatal(err)
+	}
+	if !g.IsTier1(174) || g.IsTier1(6939) {
+		t.Error("clique from the header comment not used")
+	}
+	if got := g.Ancestors(64501); !reflect.DeepEqual(got, [][]uint32{{64500}, {174, 6939}, {1299}}) {
+		t.Errorf("ancestors of 64501 = %v", got)
+	}
+	if got := g.CustomerCone(1299); got != 4 {
+		t.Errorf("customer cone of 1299 = %d", got)
+	}
+	// 没有Tier-1集合注释时，有客户但没有提供者的AS视为Tier-1
+	g = New()
+	g.Add(1299, 6939, ProviderToCustomer)
+	g.Add(6939, 64500, ProviderToCustomer)
+	if !g.IsTier1(1299) || g.IsTier1(6939) || g.IsTier1(64500) {
+		t.Error("transit-free AS not inferred as Tier-1")
+	}
+	// serial-2 的第4列被忽略
+	g = New()
+	if err := g.Load(strings.NewReader("174|64500|-1|bgp\n")); err != nil || g.Len() != 1 {
+		t.Errorf("serial-2: %v, %d links", err, g.Len())
+	}
+	for _, bad := range []string{"174|64500\n", "x|64500|-1\n", "174|64500|2\n"} {
+		if err := New().Load(strings.NewReader(bad)); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package bgptools
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strconv"
+
+	"github.com/oneclickvirt/backtrace/asndb"
+	"github.com/oneclickvirt/backtrace/asrel"
+	"github.com/oneclickvirt/backtrace/model"
+)
+
+// CAIDA 根据本地 CAIDA AS Relationships 数据集推断上游，无需联网：
+// 地址的源ASN由离线ASN数据库查询，上游由真实的提供者关系而非连通性图的颜色确定
+type CAIDA struct {
+	Graph *asrel.Graph
+	ASNDB *asndb.DB // 查询地址的源ASN及AS名称
+}
+
+// Name 实现 UpstreamProvider
+func (c *CAIDA) Name() string { return ProviderCAIDA }
+
+// Upstreams 实现 UpstreamProvider
+func (c *CAIDA) Upstreams(ctx context.Context, ip string) (*PoPResult, error) {
+	if c.Graph == nil || c.ASNDB == nil {
+		return nil, fmt.Errorf("CAIDA上游查询需要AS关系数据集及离线ASN数据库")
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IP address: %s", ip)
+	}
+	rec, ok := c.ASNDB.Lookup(addr.Unmap())
+	if !ok {
+		return nil, fmt.Errorf("离线ASN数据库中没有 %s 的记录", ip)
+	}
+	upstreams := InferUpstreams(c.Graph, rec.ASN, c.ASNDB.Name)
+	if len(upstreams) == 0 {
+		return nil, fmt.Errorf("AS关系数据集中没有AS%d的提供者", rec.ASN)
+	}
+	result := newPoPResult(strconv.FormatUint(uint64(rec.ASN), 10), upstreams)
+	result.ConeSize = c.Graph.CustomerCone(rec.ASN)
+	result.Result = fmt.Sprintf("AS%d 客户锥: %d 个AS\n", rec.ASN, result.ConeSize) + result.Result
+	return result, nil
+}
+
+// InferUpstreams 根据AS关系计算 asn 的上游：全部直接提供者，以及沿提供者层级可达的Tier-1，
+// 按层数及ASN排列。name 返回AS名称，可为nil
+func InferUpstreams(g *asrel.Graph, asn uint32, name func(uint32) string) []Upstream {
+	var upstreams []Upstream
+	for i, level := range g.Ancestors(asn) {
+		direct := i == 0
+		for _, a := range level {
+			tier1 := g.IsTier1(a)
+			if !direct && !tier1 {
+				continue
+			}
+			s := strconv.FormatUint(uint64(a), 10)
+			u := Upstream{
+				ASN:      s,
+				Direct:   direct,
+				Tier1:    tier1,
+				Type:     relationshipType(s, tier1, direct),
+				Depth:    i + 1,
+				ConeSize: g.CustomerCone(a),
+			}
+			if name != nil {
+				u.Name = name(a)
+			}
+			upstreams = append(upstreams, u)
+		}
+	}
+	return upstreams
+}
+
+// relationshipType 与 getISPType 相同，但Tier-1由AS关系确定，
+// 不在内置列表中的直连Tier-1按全球Tier-1处理
+func relationshipType(asn string, tier1, direct bool) string {
+	if tier1 && direct && model.Tier1Global[asn] == "" && model.Tier1Regional[asn] == "" {
+		return "Tier1 Global"
+	}
+	return getISPType(asn, tier1, direct)
+}
@@ -1,6 +1,7 @@
 package bgptools
 
 import (
+	"context"
 	"fmt"
 	"html"
 	"io"
@@ -29,17 +30,20 @@ type Arrow struct {
 }
 
 type Upstream struct {
-	ASN    string
-	Name   string
-	Direct bool
-	Tier1  bool
-	Type   string
+	ASN      string `json:"asn"`
+	Name     string `json:"name"`
+	Direct   bool   `json:"direct"`
+	Tier1    bool   `json:"tier1"`
+	Type     string `json:"type"`
+	Depth    int    `json:"depth,omitempty"`     // 在提供者层级中的层数，1为直接上游，仅根据AS关系推断时给出
+	ConeSize int    `json:"cone_size,omitempty"` // 客户锥大小，仅根据AS关系推断时给出
 }
 
 type PoPResult struct {
-	TargetASN string
-	Upstreams []Upstream
-	Result    string
+	TargetASN string     `json:"target_asn"`
+	ConeSize  int        `json:"cone_size,omitempty"` // 目标AS的客户锥大小，仅根据AS关系推断时给出
+	Upstreams []Upstream `json:"upstreams"`
+	Result    string     `json:"-"`
 }
 
 type retryConfig struct {
@@ -52,11 +56,12 @@ var defaultRetryConfig = retryConfig{
 	timeouts:   []time.Duration{5 * time.Second, 6 * time.Second},
 }
 
-func executeWithRetry(client *req.Client, url string, config retryConfig) (*req.Response, error) {
+func executeWithRetry(ctx context.Context, client *req.Client, url string, config retryConfig) (*req.Response, error) {
 	var lastErr error
 	for attempt := 0; attempt < config.maxRetries; attempt++ {
 		timeout := config.timeouts[attempt]
 		resp, err := client.SetTimeout(timeout).R().
+			SetContext(ctx).
 			Get(url)
 		if err == nil && resp.StatusCode == 200 {
 			return resp, nil
@@ -66,8 +71,8 @@ func executeWithRetry(client *req.Client, url string, config retryConfig) (*req.
 		} else {
 			lastErr = fmt.Errorf("attempt %d failed with HTTP status %d (timeout %v)", attempt+1, resp.StatusCode, timeout)
 		}
-		if attempt < config.maxRetries-1 {
-			time.Sleep(1 * time.Second)
+		if attempt < config.maxRetries-1 && sleep(ctx, time.Second) != nil {
+			break
 		}
 	}
 	return nil, fmt.Errorf("all %d attempts failed, last error: %w", config.maxRetries, lastErr)
@@ -108,15 +113,15 @@ func isValidIP(ip string) bool {
 	return net.ParseIP(ip) != nil
 }
 
-func getSVGPath(ip string) (string, error) {
+func getSVGPath(ctx context.Context, baseURL, ip string) (string, error) {
 	if !isValidIP(ip) {
 		return "", fmt.Errorf("invalid IP address: %s", ip)
 	}
 	var lastErr error
 	for attempt := 0; attempt < defaultRetryConfig.maxRetries; attempt++ {
 		client := req.C().ImpersonateChrome()
-		url := fmt.Sprintf("https://bgp.tools/prefix/%s#connectivity", ip)
-		resp, err := executeWithRetry(client, url, defaultRetryConfig)
+		url := fmt.Sprintf("%s/prefix/%s#connectivity", baseURL, ip)
+		resp, err := executeWithRetry(ctx, client, url, defaultRetryConfig)
 		if err == nil && resp != nil {
 			if resp.Body != nil {
 				defer resp.Body.Close()
@@ -131,20 +136,20 @@ func getSVGPath(ip string) (string, error) {
 		} else {
 			lastErr = fmt.Errorf("failed to fetch BGP info for IP %s: %w", ip, err)
 		}
-		if attempt < defaultRetryConfig.maxRetries-1 {
-			time.Sleep(1 * time.Second)
+		if attempt < defaultRetryConfig.maxRetries-1 && sleep(ctx, time.Second) != nil {
+			break
 		}
 	}
 	return "", fmt.Errorf("failed to get SVG path after %d retries: %w", defaultRetryConfig.maxRetries, lastErr)
 }
 
-func downloadSVG(svgPath string) (string, error) {
+func downloadSVG(ctx context.Context, baseURL, svgPath string) (string, error) {
 	var lastErr error
 	for attempt := 0; attempt < defaultRetryConfig.maxRetries; attempt++ {
 		client := req.C().ImpersonateChrome()
 		uuid := uuid.NewString()
-		url := fmt.Sprintf("https://bgp.tools%s?%s&loggedin", svgPath, uuid)
-		resp, err := executeWithRetry(client, url, defaultRetryConfig)
+		url := fmt.Sprintf("%s%s?%s&loggedin", baseURL, svgPath, uuid)
+		resp, err := executeWithRetry(ctx, client, url, defaultRetryConfig)
 		if err == nil && resp != nil && resp.Body != nil {
 			defer resp.Body.Close()
 			bodyBytes, err := io.ReadAll(resp.Body)
@@ -155,8 +160,8 @@ func downloadSVG(svgPath string) (string, error) {
 		} else {
 			lastErr = fmt.Errorf("failed to download SVG: %w", err)
 		}
-		if attempt < defaultRetryConfig.maxRetries-1 {
-			time.Sleep(1 * time.Second)
+		if attempt < defaultRetryConfig.maxRetries-1 && sleep(ctx, time.Second) != nil {
+			break
 		}
 	}
 	return "", fmt.Errorf("failed to download SVG after %d retries: %w", defaultRetryConfig.maxRetries, lastErr)
@@ -233,9 +238,10 @@ func findUpstreams(targetASN string, nodes []ASCard, edges []Arrow) []Upstream {
 		}
 	}
 	var upstreams []Upstream
-	addedASNs := map[string]bool{}
+	// 目标自身及重复的节点不作为上游
+	addedASNs := map[string]bool{targetASN: true}
 	for _, n := range nodes {
-		if !upstreamMap[n.ASN] {
+		if !upstreamMap[n.ASN] || addedASNs[n.ASN] {
 			continue
 		}
 		isTier1 := (n.Fill == "white" && n.Stroke == "#005ea5")
@@ -342,18 +348,48 @@ func findUpstreams(targetASN string, nodes []ASCard, edges []Arrow) []Upstream {
 	return upstreams
 }
 
-func GetPoPInfo(ip string) (*PoPResult, error) {
+// sleep 等待 d 或直到 ctx 结束
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// BGPTools 从 bgp.tools 前缀页面的连通性图（graphviz 生成的SVG）中解析上游
+type BGPTools struct {
+	BaseURL string // 为空时使用 https://bgp.tools
+}
+
+// Name 实现 UpstreamProvider
+func (b *BGPTools) Name() string { return ProviderBGPTools }
+
+// Upstreams 实现 UpstreamProvider
+func (b *BGPTools) Upstreams(ctx context.Context, ip string) (*PoPResult, error) {
 	if ip == "" {
 		return nil, fmt.Errorf("IP address cannot be empty")
 	}
-	svgPath, err := getSVGPath(ip)
+	baseURL := b.BaseURL
+	if baseURL == "" {
+		baseURL = "https://bgp.tools"
+	}
+	svgPath, err := getSVGPath(ctx, baseURL, ip)
 	if err != nil {
 		return nil, fmt.Errorf("获取SVG路径失败: %w", err)
 	}
-	svg, err := downloadSVG(svgPath)
+	svg, err := downloadSVG(ctx, baseURL, svgPath)
 	if err != nil {
 		return nil, fmt.Errorf("下载SVG失败: %w", err)
 	}
+	return parseSVG(svg)
+}
+
+// parseSVG 从连通性图中识别目标ASN及其上游
+func parseSVG(svg string) (*PoPResult, error) {
 	nodes, edges := parseASAndEdges(svg)
 	if len(nodes) == 0 {
 		return nil, fmt.Errorf("未找到任何AS节点")
@@ -362,7 +398,16 @@ func GetPoPInfo(ip string) (*PoPResult, error) {
 	if targetASN == "" {
 		return nil, fmt.Errorf("无法识别目标 ASN")
 	}
-	upstreams := findUpstreams(targetASN, nodes, edges)
+	return newPoPResult(targetASN, findUpstreams(targetASN, nodes, edges)), nil
+}
+
+// GetPoPInfo 使用 bgp.tools 查询地址所在网络的上游
+func GetPoPInfo(ip string) (*PoPResult, error) {
+	return (&BGPTools{}).Upstreams(context.Background(), ip)
+}
+
+// newPoPResult 构造查询结果，并将上游渲染为每行5个的文本
+func newPoPResult(targetASN string, upstreams []Upstream) *PoPResult {
 	colWidth := 18
 	center := func(s string) string {
 		runeLen := len([]rune(s))
@@ -403,5 +448,5 @@ func GetPoPInfo(ip string) (*PoPResult, error) {
 		TargetASN: targetASN,
 		Upstreams: upstreams,
 		Result:    result.String(),
-	}, nil
+	}
 }
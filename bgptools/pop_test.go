@@ -1,19 +1,19 @@
 package bgptools
 
 import (
-	"fmt"
 	"testing"
 )
 
 func TestGetPoPInfo(t *testing.T) {
+	if testing.Short() {
+		t.Skip("requires access to bgp.tools")
+	}
 	result, err := GetPoPInfo("23.128.228.123")
 	if err != nil {
-		fmt.Println(err.Error())
-		return
+		t.Skipf("bgp.tools unavailable: %v", err)
+	}
+	if result.TargetASN == "" || len(result.Upstreams) == 0 {
+		t.Errorf("incomplete result: %+v", result)
 	}
-	fmt.Printf("目标 ASN: %s\n", result.TargetASN)
-	fmt.Println(len(result.Upstreams))
-	fmt.Println(result.Upstreams)
-	fmt.Println("上游信息:")
-	fmt.Print(result.Result)
+	t.Logf("目标 ASN: %s\n%s", result.TargetASN, result.Result)
 }
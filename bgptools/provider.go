@@ -0,0 +1,24 @@
+package bgptools
+
+import "context"
+
+// 上游查询方式
+const (
+	ProviderBGPTools = "bgptools" // 解析 bgp.tools 的连通性图
+	ProviderRIPEstat = "ripestat" // RIPEstat Data API 的 JSON 接口
+	ProviderCAIDA    = "caida"    // 本地 CAIDA AS Relationships 数据集
+)
+
+// UpstreamProvider 查询地址所在网络（目标ASN）的上游
+type UpstreamProvider interface {
+	// Name 返回查询方式的名称，如 ProviderBGPTools
+	Name() string
+	// Upstreams 返回地址所在的ASN及其上游
+	Upstreams(ctx context.Context, ip string) (*PoPResult, error)
+}
+
+var (
+	_ UpstreamProvider = (*BGPTools)(nil)
+	_ UpstreamProvider = (*RIPEstat)(nil)
+	_ UpstreamProvider = (*CAIDA)(nil)
+)
@@ -0,0 +1,132 @@
+package bgptools
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oneclickvirt/backtrace/asndb"
+	"github.com/oneclickvirt/backtrace/asrel"
+)
+
+// checkUpstreams 比较上游的ASN、是否直连及类型
+func checkUpstreams(t *testing.T, result *PoPResult, targetASN string, want []Upstream) {
+	t.Helper()
+	if result.TargetASN != targetASN {
+		t.Errorf("target ASN = %s, want %s", result.TargetASN, targetASN)
+	}
+	if len(result.Upstreams) != len(want) {
+		t.Fatalf("got %d upstreams %+v, want %d", len(result.Upstreams), result.Upstreams, len(want))
+	}
+	for i, w := range want {
+		got := result.Upstreams[i]
+		if got.ASN != w.ASN || got.Direct != w.Direct || got.Tier1 != w.Tier1 || got.Type != w.Type || (w.Name != "" && got.Name != w.Name) {
+			t.Errorf("upstream %d = %+v, want %+v", i, got, w)
+		}
+	}
+	if result.Result == "" {
+		t.Error("empty text result")
+	}
+}
+
+func TestBGPToolsFixture(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/prefix/192.0.2.1":
+			http.ServeFile(w, r, "testdata/bgptools/prefix.html")
+		case "/pathimg/rt-192.0.2.0_24":
+			w.Header().Set("Content-Type", "image/svg+xml")
+			http.ServeFile(w, r, "testdata/bgptools/path.svg")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	p := &BGPTools{BaseURL: srv.URL}
+	result, err := p.Upstreams(context.Background(), "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUpstreams(t, result, "64500", []Upstream{
+		{ASN: "174", Name: "Cogent Communications", Direct: true, Tier1: true, Type: "Tier1 Global"},
+		{ASN: "6939", Name: "Hurricane Electric LLC", Direct: true, Type: "Tier2"},
+		{ASN: "1299", Direct: false, Tier1: true, Type: "Tier1 Indirect"},
+	})
+}
+
+func TestRIPEstatFixture(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := filepath.Base(filepath.Dir(r.URL.Path))
+		name := filepath.Join("testdata/ripestat", call+"-"+r.URL.Query().Get("resource")+".json")
+		if _, err := os.Stat(name); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, name)
+	}))
+	defer srv.Close()
+	p := &RIPEstat{BaseURL: srv.URL}
+	result, err := p.Upstreams(context.Background(), "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 只保留左侧邻居，并按路由可见度排列
+	checkUpstreams(t, result, "64500", []Upstream{
+		{ASN: "174", Name: "Cogent Communications", Direct: true, Tier1: true, Type: "Tier1 Global"},
+		{ASN: "6939", Name: "Hurricane Electric LLC", Direct: true, Type: "Tier2"},
+	})
+	if _, err := p.Upstreams(context.Background(), "198.51.100.1"); err == nil {
+		t.Error("missing fixture did not fail")
+	}
+}
+
+func TestCAIDAFixture(t *testing.T) {
+	graph, err := asrel.Open("testdata/caida/as-rel.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := asndb.Open("testdata/caida/ip2asn.tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := os.Open("testdata/caida/asnames.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer names.Close()
+	if err := db.LoadNames(names); err != nil {
+		t.Fatal(err)
+	}
+	p := &CAIDA{Graph: graph, ASNDB: db}
+	result, err := p.Upstreams(context.Background(), "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUpstreams(t, result, "64500", []Upstream{
+		{ASN: "174", Name: "COGENT-174", Direct: true, Tier1: true, Type: "Tier1 Global"},
+		{ASN: "6939", Name: "HURRICANE", Direct: true, Type: "Tier2"},
+		{ASN: "1299", Name: "TWELVE99", Direct: false, Tier1: true, Type: "Tier1 Indirect"},
+	})
+	// 间接上游只列出沿提供者层级可达的Tier-1
+	result, err = p.Upstreams(context.Background(), "198.51.100.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUpstreams(t, result, "64511", []Upstream{
+		{ASN: "64510", Name: "EXAMPLE-TRANSIT", Direct: true, Type: "Direct"},
+		{ASN: "1299", Direct: false, Tier1: true, Type: "Tier1 Indirect"},
+	})
+	if u := result.Upstreams[1]; u.Depth != 3 || u.ConeSize != 5 {
+		t.Errorf("AS1299 depth %d, cone %d", u.Depth, u.ConeSize)
+	}
+	if result.ConeSize != 1 || !strings.HasPrefix(result.Result, "AS64511 客户锥: 1 个AS\n") {
+		t.Errorf("target cone %d, output %q", result.ConeSize, result.Result)
+	}
+	if _, err := p.Upstreams(context.Background(), "203.0.113.1"); err == nil {
+		t.Error("address without origin ASN did not fail")
+	}
+}
@@ -0,0 +1,138 @@
+package bgptools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oneclickvirt/backtrace/model"
+)
+
+// RIPEstat 通过 RIPEstat Data API（或兼容的镜像）的JSON接口查询上游：
+// network-info 给出地址的源ASN，asn-neighbours 中位于左侧（更靠近核心网络）的邻居视为直接上游，
+// 按路由可见度（power）从高到低排列
+type RIPEstat struct {
+	BaseURL string       // 为空时使用 https://stat.ripe.net
+	Max     int          // 最多返回的上游数量，为0时为10
+	Client  *http.Client // 为nil时使用超时10秒的默认客户端
+}
+
+type ripeNetworkInfo struct {
+	ASNs   []string `json:"asns"`
+	Prefix string   `json:"prefix"`
+}
+
+type ripeNeighbours struct {
+	Neighbours []struct {
+		ASN   int    `json:"asn"`
+		Type  string `json:"type"`
+		Power int    `json:"power"`
+	} `json:"neighbours"`
+}
+
+type ripeOverview struct {
+	Holder string `json:"holder"`
+}
+
+// Name 实现 UpstreamProvider
+func (r *RIPEstat) Name() string { return ProviderRIPEstat }
+
+// Upstreams 实现 UpstreamProvider
+func (r *RIPEstat) Upstreams(ctx context.Context, ip string) (*PoPResult, error) {
+	if !isValidIP(ip) {
+		return nil, fmt.Errorf("invalid IP address: %s", ip)
+	}
+	var info ripeNetworkInfo
+	if err := r.get(ctx, "network-info", net.ParseIP(ip).String(), &info); err != nil {
+		return nil, err
+	}
+	if len(info.ASNs) == 0 {
+		return nil, fmt.Errorf("无法识别目标 ASN")
+	}
+	targetASN := info.ASNs[0]
+	var neighbours ripeNeighbours
+	if err := r.get(ctx, "asn-neighbours", "AS"+targetASN, &neighbours); err != nil {
+		return nil, err
+	}
+	left := neighbours.Neighbours[:0]
+	for _, n := range neighbours.Neighbours {
+		if n.Type == "left" {
+			left = append(left, n)
+		}
+	}
+	sort.SliceStable(left, func(i, j int) bool { return left[i].Power > left[j].Power })
+	max := r.Max
+	if max <= 0 {
+		max = 10
+	}
+	if len(left) > max {
+		left = left[:max]
+	}
+	upstreams := make([]Upstream, 0, len(left))
+	for _, n := range left {
+		asn := strconv.Itoa(n.ASN)
+		var overview ripeOverview
+		// 名称只用于展示，查询失败时保留为空
+		_ = r.get(ctx, "as-overview", "AS"+asn, &overview)
+		tier1 := model.Tier1Global[asn] != "" || model.Tier1Regional[asn] != ""
+		upstreams = append(upstreams, Upstream{
+			ASN:    asn,
+			Name:   holderName(overview.Holder),
+			Direct: true,
+			Tier1:  tier1,
+			Type:   getISPType(asn, tier1, true),
+		})
+	}
+	return newPoPResult(targetASN, upstreams), nil
+}
+
+// get 请求 /data/{call}/data.json?resource=... 并将 data 字段解码到 v
+func (r *RIPEstat) get(ctx context.Context, call, resource string, v interface{}) error {
+	baseURL := r.BaseURL
+	if baseURL == "" {
+		baseURL = "https://stat.ripe.net"
+	}
+	client := r.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	u := fmt.Sprintf("%s/data/%s/data.json?resource=%s", strings.TrimSuffix(baseURL, "/"), call, url.QueryEscape(resource))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("RIPEstat %s: %w", call, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("RIPEstat %s: %s", call, resp.Status)
+	}
+	var body struct {
+		Status string          `json:"status"`
+		Data   json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("RIPEstat %s: %w", call, err)
+	}
+	if body.Status != "" && body.Status != "ok" {
+		return fmt.Errorf("RIPEstat %s: status %s", call, body.Status)
+	}
+	return json.Unmarshal(body.Data, v)
+}
+
+// holderName 从 "COGENT-174 - Cogent Communications" 形式的持有者中取出名称
+func holderName(holder string) string {
+	if _, name, ok := strings.Cut(holder, " - "); ok {
+		return strings.TrimSpace(name)
+	}
+	return strings.TrimSpace(holder)
+}
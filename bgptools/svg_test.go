@@ -0,0 +1,169 @@
+package bgptools
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/svg/*.golden")
+
+// golden 为SVG样本的期望解析结果，Rendered 为逐行的终端输出（含颜色），解析失败时只记录错误
+type golden struct {
+	Result   *PoPResult `json:"result,omitempty"`
+	Rendered []string   `json:"rendered,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// svgCorpus 返回 testdata/svg 下录制的连通性图
+func svgCorpus(t testing.TB) []string {
+	files, err := filepath.Glob("testdata/svg/*.svg")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no SVG fixtures: %v", err)
+	}
+	return files
+}
+
+func TestParseSVGGolden(t *testing.T) {
+	for _, file := range svgCorpus(t) {
+		name := strings.TrimSuffix(filepath.Base(file), ".svg")
+		t.Run(name, func(t *testing.T) {
+			svg, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got golden
+			result, err := parseSVG(string(svg))
+			if err != nil {
+				got.Error = err.Error()
+			} else {
+				got.Result = result
+				if result.Result != "" {
+					got.Rendered = strings.Split(strings.TrimSuffix(result.Result, "\n"), "\n")
+				}
+			}
+			data, err := json.MarshalIndent(got, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			data = append(data, '\n')
+			path := strings.TrimSuffix(file, ".svg") + ".golden"
+			if *update {
+				if err := os.WriteFile(path, data, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+			if !bytes.Equal(data, want) {
+				t.Errorf("result differs from %s:\n%s", path, data)
+			}
+		})
+	}
+}
+
+// addSVGSeeds 以录制的连通性图作为模糊测试的初始语料
+func addSVGSeeds(f *testing.F) {
+	for _, file := range svgCorpus(f) {
+		svg, err := os.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(svg))
+	}
+	path, err := os.ReadFile("testdata/bgptools/path.svg")
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(string(path))
+	// 自环边及重复的节点
+	f.Add(`<g id="node1" class="node"><title>AS1</title><polygon fill="limegreen" stroke="black"/></g>` +
+		`<g id="edge1" class="edge"><title>AS1->AS1</title></g>`)
+	f.Add(`<g id="node1" class="node"><title>AS1</title><polygon fill="green"/></g>` +
+		`<g id="node2" class="node"><title>AS2</title></g><g id="node3" class="node"><title>AS2</title></g>` +
+		`<g id="edge1" class="edge"><title>AS1->AS2</title></g>`)
+}
+
+func isASN(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
+func FuzzParseASAndEdges(f *testing.F) {
+	addSVGSeeds(f)
+	f.Fuzz(func(t *testing.T, svg string) {
+		nodes, edges := parseASAndEdges(svg)
+		for _, n := range nodes {
+			if !isASN(n.ASN) || n.Name == "" || n.Fill == "" || n.Stroke == "" {
+				t.Errorf("invalid node %+v", n)
+			}
+		}
+		for _, e := range edges {
+			if !isASN(e.From) || !isASN(e.To) {
+				t.Errorf("invalid edge %+v", e)
+			}
+		}
+	})
+}
+
+func FuzzFindTargetASN(f *testing.F) {
+	addSVGSeeds(f)
+	f.Fuzz(func(t *testing.T, svg string) {
+		nodes, _ := parseASAndEdges(svg)
+		target := findTargetASN(nodes)
+		if len(nodes) == 0 {
+			if target != "" {
+				t.Errorf("target %s without nodes", target)
+			}
+			return
+		}
+		for _, n := range nodes {
+			if n.ASN == target {
+				return
+			}
+		}
+		t.Errorf("target %s is not a node", target)
+	})
+}
+
+func FuzzFindUpstreams(f *testing.F) {
+	addSVGSeeds(f)
+	f.Fuzz(func(t *testing.T, svg string) {
+		nodes, edges := parseASAndEdges(svg)
+		target := findTargetASN(nodes)
+		direct := map[string]bool{}
+		for _, e := range edges {
+			if e.From == target {
+				direct[e.To] = true
+			}
+		}
+		known := map[string]bool{}
+		for _, n := range nodes {
+			known[n.ASN] = true
+		}
+		seen := map[string]bool{}
+		indirect := false
+		for _, u := range findUpstreams(target, nodes, edges) {
+			switch {
+			case u.ASN == target:
+				t.Errorf("target %s listed as its own upstream", target)
+			case seen[u.ASN]:
+				t.Errorf("duplicate upstream %s", u.ASN)
+			case !known[u.ASN]:
+				t.Errorf("upstream %s is not a node", u.ASN)
+			case u.Direct && (indirect || !direct[u.ASN]):
+				t.Errorf("unexpected direct upstream %+v", u)
+			case u.Type == "":
+				t.Errorf("upstream %s without type", u.ASN)
+			}
+			seen[u.ASN] = true
+			indirect = indirect || !u.Direct
+		}
+	})
+}
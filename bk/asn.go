@@ -0,0 +1,107 @@
+package backtrace
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/oneclickvirt/backtrace/iptrie"
+	. "github.com/oneclickvirt/defaultset"
+)
+
+//go:embed prefix/ipv4.txt
+var ipv4PrefixData string
+
+//go:embed prefix/as4809.txt
+var as4809Data string
+
+//go:embed prefix/as4134.txt
+var as4134Data string
+
+//go:embed prefix/as9929.txt
+var as9929Data string
+
+//go:embed prefix/as4837.txt
+var as4837Data string
+
+//go:embed prefix/as58807.txt
+var as58807Data string
+
+//go:embed prefix/as9808.txt
+var as9808Data string
+
+//go:embed prefix/as58453.txt
+var as58453Data string
+
+//go:embed prefix/as23764.txt
+var as23764Data string
+
+// ASN -> IPv6 前缀列表。
+// 现有文件由旧版按16位分组截断的文本前缀换算而来（/16、/32、/48 等），并非 bgp.he.net 公布的原始CIDR，
+// 非16位对齐的宣告（如 /29、/33）会被放宽或收窄，结果仅为近似，需由 build.yml 工作流重新生成后才与真实宣告一致
+var asnPrefixes = map[string]string{
+	"AS4809":  as4809Data,  // 电信 CN2 GT/GIA
+	"AS4134":  as4134Data,  // 电信 163 骨干网
+	"AS9929":  as9929Data,  // 联通 9929 优质国际线路
+	"AS4837":  as4837Data,  // 联通 AS4837 普通国际线路
+	"AS58807": as58807Data, // 移动 CMIN2 国际精品网
+	"AS9808":  as9808Data,  // 移动 CMI（中国移动国际公司）
+	"AS58453": as58453Data, // 移动国际互联网（CMI/HK）
+	"AS23764": as23764Data, // 电信 CTGNET/国际出口（可能是CN2-B）
+}
+
+// asnTable 内置前缀到ASN的最长前缀匹配表
+var asnTable = newASNTable()
+
+func newASNTable() *iptrie.Table[string] {
+	table := &iptrie.Table[string]{}
+	// IPv6 前缀按ASN分文件存放，每行一个CIDR，无法解析的行（如注释）被忽略
+	for asn, data := range asnPrefixes {
+		for _, line := range strings.Split(data, "\n") {
+			if prefix, err := netip.ParsePrefix(strings.TrimSpace(line)); err == nil {
+				table.Insert(prefix.Masked(), asn)
+			}
+		}
+	}
+	// IPv4 前缀每行为 "CIDR ASN"
+	scanner := bufio.NewScanner(strings.NewReader(ipv4PrefixData))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(fields[0]); err == nil {
+			table.Insert(prefix.Masked(), fields[1])
+		}
+	}
+	return table
+}
+
+// lookupASN 返回地址所属的已知线路ASN，未知时返回空字符串
+func lookupASN(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	asn, _ := asnTable.Lookup(addr)
+	return asn
+}
+
+// extractASNsFromHops 按跃点顺序从节点中提取ASN列表
+func extractASNsFromHops(hops []*Hop, enableLogger bool) []string {
+	var asns []string
+	for _, h := range hops {
+		for _, n := range h.Nodes {
+			asn := lookupASN(n.IP.String())
+			if asn != "" {
+				asns = append(asns, asn)
+				if enableLogger {
+					Logger.Info(fmt.Sprintf("IP %s 对应的ASN: %s", n.IP.String(), asn))
+				}
+			}
+		}
+	}
+	return asns
+}
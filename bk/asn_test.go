@@ -0,0 +1,106 @@
+package backtrace
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestLookupASN(t *testing.T) {
+	cases := map[string]string{
+		"59.43.182.1":       "AS4809",
+		"202.97.12.1":       "AS4134",
+		"219.158.3.1":       "AS4837",
+		"223.120.19.5":      "AS58807",
+		"223.120.190.5":     "AS58453",
+		"223.119.8.1":       "AS58453",
+		"1.1.1.1":           "",
+		"2400:9380:9001::1": "AS4809",
+		"2400:9380:8001::1": "AS4134",
+		"2001:db8::1":       "",
+		"not-an-ip":         "",
+	}
+	for ip, want := range cases {
+		if got := lookupASN(ip); got != want {
+			t.Errorf("lookupASN(%s) = %q, want %q", ip, got, want)
+		}
+	}
+}
+
+// legacyPrefixes 按旧版格式（保留 bits/16 组的文本前缀）还原的IPv6前缀表
+func legacyPrefixes() map[string][]string {
+	m := make(map[string][]string)
+	for asn, data := range asnPrefixes {
+		for _, line := range strings.Split(data, "\n") {
+			prefix, err := netip.ParsePrefix(strings.TrimSpace(line))
+			if err != nil {
+				continue
+			}
+			b := prefix.Addr().As16()
+			var groups []string
+			for i := 0; i < prefix.Bits()/16; i++ {
+				groups = append(groups, fmt.Sprintf("%x", uint16(b[2*i])<<8|uint16(b[2*i+1])))
+			}
+			m[asn] = append(m[asn], strings.Join(groups, ":"))
+		}
+	}
+	return m
+}
+
+// legacyLookupASN 旧版基于字符串前缀的实现，仅用于基准对比
+func legacyLookupASN(prefixes map[string][]string, ip string) string {
+	if strings.Contains(ip, ":") {
+		ip = strings.ToLower(ip)
+		for asn, list := range prefixes {
+			for _, prefix := range list {
+				if strings.HasPrefix(ip, prefix) {
+					return asn
+				}
+			}
+		}
+		return ""
+	}
+	switch {
+	case strings.HasPrefix(ip, "59.43"):
+		return "AS4809"
+	case strings.HasPrefix(ip, "202.97"):
+		return "AS4134"
+	case strings.HasPrefix(ip, "218.105") || strings.HasPrefix(ip, "210.51"):
+		return "AS9929"
+	case strings.HasPrefix(ip, "219.158"):
+		return "AS4837"
+	case strings.HasPrefix(ip, "223.120.19") || strings.HasPrefix(ip, "223.120.17") || strings.HasPrefix(ip, "223.120.16") ||
+		strings.HasPrefix(ip, "223.120.140") || strings.HasPrefix(ip, "223.120.130") || strings.HasPrefix(ip, "223.120.131") ||
+		strings.HasPrefix(ip, "223.120.141"):
+		return "AS58807"
+	case strings.HasPrefix(ip, "223.118") || strings.HasPrefix(ip, "223.119") || strings.HasPrefix(ip, "223.120") || strings.HasPrefix(ip, "223.121"):
+		return "AS58453"
+	case strings.HasPrefix(ip, "69.194") || strings.HasPrefix(ip, "203.22"):
+		return "AS23764"
+	}
+	return ""
+}
+
+var benchIPs = []string{
+	"59.43.182.1", "202.97.12.1", "223.120.19.5", "8.8.8.8", "192.168.1.1",
+	"2400:9380:9001::1", "2408:8120:1::1", "2409:8080::1", "2001:db8::1", "2606:4700::1111",
+}
+
+func BenchmarkLookupASN(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		for _, ip := range benchIPs {
+			lookupASN(ip)
+		}
+	}
+}
+
+func BenchmarkLegacyLookupASN(b *testing.B) {
+	prefixes := legacyPrefixes()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, ip := range benchIPs {
+			legacyLookupASN(prefixes, ip)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package backtrace
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ASSegment 回程路径上连续属于同一ASN的一段节点
+type ASSegment struct {
+	ASN      string        `json:"asn"`
+	Line     string        `json:"line,omitempty"` // ASN对应的线路简称
+	FirstHop int           `json:"first_hop"`      // 该段第一个节点的跳数
+	LastHop  int           `json:"last_hop"`       // 该段最后一个节点的跳数
+	Ingress  string        `json:"ingress"`        // 进入该AS的第一个节点
+	Egress   string        `json:"egress"`         // 离开该AS前的最后一个节点
+	Latency  time.Duration `json:"latency"`        // 该段贡献的时延：出口节点平均RTT减去上一段出口节点平均RTT
+}
+
+// nodeASN 返回节点的ASN，内置前缀表无法识别时使用离线数据库的源ASN
+func nodeASN(n *NodeResult) string {
+	if n.ASN != "" {
+		return n.ASN
+	}
+	if n.OriginASN != 0 {
+		return fmt.Sprintf("AS%d", n.OriginASN)
+	}
+	return ""
+}
+
+// buildASPath 按跳数顺序将节点归并为AS段，不可识别ASN的节点不会打断所在的段
+func buildASPath(hops []*HopResult) []ASSegment {
+	var (
+		path      []ASSegment
+		egressRTT time.Duration // 当前段出口节点的平均RTT
+		prevRTT   time.Duration // 上一段出口节点的平均RTT
+	)
+	for _, h := range hops {
+		for _, n := range h.Nodes {
+			asn := nodeASN(n)
+			if asn == "" {
+				continue
+			}
+			_, avg, _ := n.RTTStats()
+			last := len(path) - 1
+			if last < 0 || path[last].ASN != asn {
+				if last >= 0 {
+					prevRTT = egressRTT
+				}
+				path = append(path, ASSegment{ASN: asn, FirstHop: h.Distance, Ingress: n.IP})
+				last++
+			}
+			seg := &path[last]
+			if seg.Line == "" {
+				seg.Line = n.Line
+			}
+			seg.LastHop = h.Distance
+			seg.Egress = n.IP
+			egressRTT = avg
+			seg.Latency = egressRTT - prevRTT
+			if seg.Latency < 0 {
+				seg.Latency = 0
+			}
+		}
+	}
+	return path
+}
+
+// MultipleLines 返回是否识别出多个不同的线路（已按 replaces 合并，组合线路中的线路不单独计算），
+// 此时检测可能已越过汇聚层，第一个线路之后的信息可能无效
+func (r *TargetResult) MultipleLines() bool {
+	count := 0
+	for _, line := range r.Lines {
+		if line.PartOf == "" {
+			count++
+		}
+	}
+	return count > 1
+}
+
+// formatASPath 将AS路径渲染为一行，如 AS4134[163] 3-5 (12.00ms) -> AS4809[CN2] 6-8 (140.00ms)
+func formatASPath(path []ASSegment) string {
+	parts := make([]string, 0, len(path))
+	for _, seg := range path {
+		name := seg.ASN
+		if seg.Line != "" {
+			name += "[" + seg.Line + "]"
+		}
+		hops := fmt.Sprintf("%d", seg.FirstHop)
+		if seg.LastHop != seg.FirstHop {
+			hops += fmt.Sprintf("-%d", seg.LastHop)
+		}
+		parts = append(parts, fmt.Sprintf("%s %s (%sms)", name, hops, formatMillis(seg.Latency)))
+	}
+	return strings.Join(parts, " -> ")
+}
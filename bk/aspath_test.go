@@ -0,0 +1,48 @@
+package backtrace
+
+import (
+	"testing"
+	"time"
+
+	"github.com/oneclickvirt/backtrace/rules"
+)
+
+func TestBuildASPath(t *testing.T) {
+	ms := time.Millisecond
+	hops := []*HopResult{
+		{Distance: 2, Nodes: []*NodeResult{{IP: "10.0.0.1", RTT: []time.Duration{1 * ms}}}},
+		{Distance: 3, Nodes: []*NodeResult{{IP: "202.97.1.1", RTT: []time.Duration{10 * ms}, ASN: "AS4134"}}},
+		{Distance: 4, Nodes: []*NodeResult{{IP: "10.1.1.1", RTT: []time.Duration{11 * ms}}}},
+		{Distance: 5, Nodes: []*NodeResult{{IP: "202.97.2.2", RTT: []time.Duration{12 * ms, 14 * ms}, ASN: "AS4134"}}},
+		{Distance: 6, Nodes: []*NodeResult{{IP: "59.43.1.1", RTT: []time.Duration{150 * ms}, ASN: "AS4809"}}},
+		{Distance: 7, Nodes: []*NodeResult{{IP: "198.51.100.7", RTT: []time.Duration{160 * ms}, OriginASN: 64500}}},
+	}
+	annotateLines(hops, rules.Default())
+	path := buildASPath(hops)
+	want := []ASSegment{
+		{ASN: "AS4134", Line: "163", FirstHop: 3, LastHop: 5, Ingress: "202.97.1.1", Egress: "202.97.2.2", Latency: 13 * ms},
+		{ASN: "AS4809", Line: "CN2", FirstHop: 6, LastHop: 6, Ingress: "59.43.1.1", Egress: "59.43.1.1", Latency: 137 * ms},
+		{ASN: "AS64500", FirstHop: 7, LastHop: 7, Ingress: "198.51.100.7", Egress: "198.51.100.7", Latency: 10 * ms},
+	}
+	if len(path) != len(want) {
+		t.Fatalf("got %d segments, want %d: %+v", len(path), len(want), path)
+	}
+	for i := range want {
+		if path[i] != want[i] {
+			t.Errorf("segment %d = %+v, want %+v", i, path[i], want[i])
+		}
+	}
+	if got := formatASPath(path[:2]); got != "AS4134[163] 3-5 (13.00ms) -> AS4809[CN2] 6 (137.00ms)" {
+		t.Errorf("formatASPath = %q", got)
+	}
+	// 先经过163再进入CN2为CN2GT，其中的163线路不算作另一个线路；相反的顺序分别识别为CN2和163
+	r := &TargetResult{Lines: classifyLines(rules.Default(), rulePath(hops))}
+	if len(r.Lines) != 2 || r.Lines[0].Name != "CN2GT" || r.Lines[1].PartOf != "AS4809b" || r.MultipleLines() {
+		t.Errorf("163 followed by CN2: %+v", r.Lines)
+	}
+	hops[1], hops[4] = hops[4], hops[1]
+	r.Lines = classifyLines(rules.Default(), rulePath(hops))
+	if !r.MultipleLines() {
+		t.Errorf("CN2 followed by 163 not reported as multiple lines: %+v", r.Lines)
+	}
+}
@@ -1,10 +1,20 @@
 package backtrace
 
 import (
-	"strings"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
 	"time"
 
+	"github.com/oneclickvirt/backtrace/asndb"
+	"github.com/oneclickvirt/backtrace/geoip"
+	"github.com/oneclickvirt/backtrace/icmpdata"
 	"github.com/oneclickvirt/backtrace/model"
+	"github.com/oneclickvirt/backtrace/rdns"
+	"github.com/oneclickvirt/backtrace/rules"
+	. "github.com/oneclickvirt/defaultset"
 )
 
 func safeTraceCall(fn func()) {
@@ -15,90 +25,299 @@ func safeTraceCall(fn func()) {
 	fn()
 }
 
-func BackTrace(enableIpv6 bool) string {
-	if model.CachedIcmpData == "" || model.ParsedIcmpTargets == nil || time.Since(model.CachedIcmpDataFetchTime) > time.Hour {
-		model.CachedIcmpData = getData(model.IcmpTargets)
-		model.CachedIcmpDataFetchTime = time.Now()
-		if model.CachedIcmpData != "" {
-			model.ParsedIcmpTargets = parseIcmpTargets(model.CachedIcmpData)
-		}
+// DefaultTimeout 回程路由检测的默认整体超时时间
+const DefaultTimeout = 10 * time.Second
+
+// Options 回程路由检测选项
+type Options struct {
+	EnableIPv6 bool           // 是否检测IPv6目标，为false时跳过 Targets 中的IPv6目标
+	Timeout    time.Duration  // 整体超时时间，为0时使用 DefaultTimeout
+	Targets    []model.Target // 检测目标，为空时使用 model.DefaultTargets()
+	ASNDB      *asndb.DB      // 离线的地址到ASN数据库，非空时为每个节点标注源ASN及名称
+	Tracer     *Tracer        // 执行追踪的Tracer，为空时使用 DefaultTracer
+	// Trace 追踪参数。Tracer 为空且设置了追踪参数时，本次检测使用按 DefaultConfig 及这些参数创建的
+	// 独立Tracer，不会修改 DefaultTracer；Tracer 非空时由调用方配置，只有 Attempts 生效
+	Trace      TraceOptions
+	Rules      *rules.RuleSet // 线路识别规则，为空时使用 rules.Default()
+	ReverseDNS *rdns.Resolver // 非空时反向解析每个节点的地址并识别主机名中的位置信息
+	GeoIP      *geoip.DB      // 离线的地理位置数据库，非空时为每个节点标注国家、城市及坐标
+	// TargetsSource 用于匹配备选地址的ICMP目标数据来源，可为本地文件或镜像地址，为空时使用 icmpdata.DefaultSource
+	TargetsSource string
+}
+
+// tracer 返回本次检测使用的Tracer
+func (o *Options) tracer() *Tracer {
+	if o.Tracer != nil {
+		return o.Tracer
+	}
+	return DefaultTracer
+}
+
+// rules 返回本次检测使用的线路识别规则
+func (o *Options) rules() *rules.RuleSet {
+	if o.Rules != nil {
+		return o.Rules
 	}
-	var builder strings.Builder
-	if enableIpv6 {
-		ipv4Count := len(model.Ipv4s)
-		ipv6Count := len(model.Ipv6s)
-		totalCount := ipv4Count + ipv6Count
-		var (
-			s = make([]string, totalCount)
-			c = make(chan Result)
-			t = time.After(time.Second * 10)
-		)
-		for i := range model.Ipv4s {
-			idx := i
-			go safeTraceCall(func() {
-				trace(c, idx)
-			})
+	return rules.Default()
+}
+
+// selectTargets 根据选项确定本次需要检测的目标
+func selectTargets(opts Options) []model.Target {
+	targets := opts.Targets
+	if len(targets) == 0 {
+		targets = model.DefaultTargets()
+	}
+	selected := make([]model.Target, 0, len(targets))
+	for _, t := range targets {
+		if t.IPVersion == "v6" && !opts.EnableIPv6 {
+			continue
 		}
-		for i := range model.Ipv6s {
-			idx := i
-			go safeTraceCall(func() {
-				traceIPv6(c, idx, ipv4Count)
-			})
+		selected = append(selected, t)
+	}
+	return selected
+}
+
+// newTargetResult 构造目标的初始结果
+func newTargetResult(target model.Target) *TargetResult {
+	return &TargetResult{
+		Name:      target.Name,
+		IP:        target.IP,
+		ISP:       target.ISP,
+		City:      target.City,
+		IPVersion: target.IPVersion,
+	}
+}
+
+// traceTarget 对单个目标并发执行多次追踪，合并结果后识别线路，
+// ctx 结束时停止追踪并返回已获得的部分结果
+func traceTarget(ctx context.Context, target model.Target, opts Options, icmpTargets func() []model.IcmpTarget) (result *TargetResult) {
+	name, ip := target.Name, target.IP
+	tracer := opts.tracer()
+	result = newTargetResult(target)
+	// 发生panic时返回内部错误，而不是让调用方按超时处理
+	defer func() {
+		if r := recover(); r != nil {
+			result = newTargetResult(target)
+			result.Reason = ReasonInternal
+			result.Error = fmt.Sprint(r)
 		}
-	loopIPv4v6:
-		for range s {
-			select {
-			case o := <-c:
-				s[o.i] = o.s
-			case <-t:
-				break loopIPv4v6
+	}()
+	if model.EnableLoger {
+		InitLogger()
+		defer Logger.Sync()
+		Logger.Info(fmt.Sprintf("开始追踪 %s (%s)", name, ip))
+	}
+	var allHops [][]*Hop
+	var successfulTraces int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	attempts := opts.Trace.attempts()
+	for attempt := 1; attempt <= attempts; attempt++ {
+		wg.Add(1)
+		go func(attemptNum int) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+				}
+			}()
+			if model.EnableLoger {
+				Logger.Info(fmt.Sprintf("第%d次尝试追踪 %s (%s)", attemptNum, name, ip))
 			}
-		}
-		// 收集 IPv4 结果
-		for i := 0; i < ipv4Count; i++ {
-			if s[i] != "" {
-				builder.WriteString(s[i])
-				builder.WriteString("\n")
+			// 先尝试原始IP地址
+			traced := ip
+			hops, err := tracer.TraceHops(ctx, net.ParseIP(ip))
+			if err != nil && ctx.Err() == nil {
+				if model.EnableLoger {
+					Logger.Warn(fmt.Sprintf("第%d次追踪 %s (%s) 失败: %v", attemptNum, name, ip, err))
+				}
+				// 如果原始IP失败，尝试备选IP
+				if tryAltIPs := tryAlternativeIPs(target, icmpTargets); len(tryAltIPs) > 0 {
+					for _, altIP := range tryAltIPs {
+						if model.EnableLoger {
+							Logger.Info(fmt.Sprintf("第%d次尝试备选IP %s 追踪 %s", attemptNum, altIP, name))
+						}
+						traced = altIP
+						hops, err = tracer.TraceHops(ctx, net.ParseIP(altIP))
+						if (err == nil || ctx.Err() != nil) && len(hops) > 0 {
+							break // 成功找到可用IP
+						}
+					}
+				}
 			}
-		}
-		// 收集 IPv6 结果
-		for i := ipv4Count; i < totalCount; i++ {
-			if s[i] != "" {
-				builder.WriteString(s[i])
-				builder.WriteString("\n")
+			// 超时时保留已探测到的部分hop
+			if (err == nil || ctx.Err() != nil) && len(hops) > 0 {
+				mu.Lock()
+				allHops = append(allHops, hops)
+				successfulTraces++
+				if result.TracedIP == "" {
+					result.TracedIP = traced
+				}
+				mu.Unlock()
+				if model.EnableLoger {
+					Logger.Info(fmt.Sprintf("第%d次追踪 %s (%s) 成功，获得%d个hop", attemptNum, name, ip, len(hops)))
+				}
 			}
+		}(attempt)
+	}
+	// 等待所有goroutine完成
+	wg.Wait()
+	if ctx.Err() != nil {
+		result.TimedOut = true
+		if model.EnableLoger {
+			Logger.Warn(fmt.Sprintf("%s (%s) 追踪超时，仅返回部分结果", name, ip))
+		}
+	}
+	// 如果所有尝试都失败
+	if successfulTraces == 0 {
+		if result.TimedOut {
+			result.Reason = ReasonTimeout
+			return result
+		}
+		result.Reason = ReasonNoRoute
+		if model.EnableLoger {
+			Logger.Error(fmt.Sprintf("%s (%s) %d次尝试都失败，检测不到回程路由节点的IP地址", name, ip, attempts))
 		}
+		return result
+	}
+	// 合并hops结果，多路径探测模式下保留所有等价路径上的节点
+	var mergedHops []*Hop
+	if tracer.flows() > 1 {
+		mergedHops = unionHops(allHops)
 	} else {
-		ipCount := len(model.Ipv4s)
-		var (
-			s = make([]string, ipCount)
-			c = make(chan Result)
-			t = time.After(time.Second * 10)
-		)
-		for i := range model.Ipv4s {
-			idx := i
-			go safeTraceCall(func() {
-				trace(c, idx)
-			})
+		mergedHops = mergeHops(allHops)
+	}
+	if model.EnableLoger {
+		Logger.Info(fmt.Sprintf("%s (%s) 完成%d次成功追踪，合并后获得%d个hop", name, ip, successfulTraces, len(mergedHops)))
+	}
+	result.Hops = newHopResults(mergedHops)
+	annotateLoss(result.Hops, allHops, tracer.Count*tracer.flows())
+	annotateOriginASN(result.Hops, opts.ASNDB)
+	annotateLines(result.Hops, opts.rules())
+	annotateHostnames(ctx, result.Hops, opts.ReverseDNS)
+	annotateGeo(result.Hops, opts.GeoIP)
+	result.ASPath = buildASPath(result.Hops)
+	result.GeoPath = buildGeoPath(result.Hops)
+	// 从合并后的hops提取ASN
+	asns := extractASNsFromHops(mergedHops, model.EnableLoger)
+	if len(asns) == 0 {
+		result.Reason = ReasonNoASN
+		if model.EnableLoger {
+			Logger.Warn(fmt.Sprintf("%s (%s) 回程路由节点中没有可识别ASN的地址", name, ip))
 		}
-	loopIPv4:
-		for range s {
-			select {
-			case o := <-c:
-				s[o.i] = o.s
-			case <-t:
-				break loopIPv4
-			}
+		return result
+	}
+	result.ASNs = removeDuplicates(asns)
+	// 线路结论基于按跳数排列的路径，能够区分ASN出现的先后顺序
+	result.Lines = classifyLines(opts.rules(), rulePath(result.Hops))
+	if len(result.Lines) == 0 {
+		result.Reason = ReasonNoKnownLine
+		if model.EnableLoger {
+			Logger.Warn(fmt.Sprintf("%s (%s) 检测不到已知线路的ASN", name, ip))
 		}
-		// 收集结果
-		for _, r := range s {
-			if r != "" {
-				builder.WriteString(r)
-				builder.WriteString("\n")
-			}
+	}
+	if model.EnableLoger {
+		for _, line := range result.Lines {
+			Logger.Info(fmt.Sprintf("%s (%s) 线路识别为: %s", name, ip, line.Description))
+		}
+	}
+	return result
+}
+
+// loadIcmpTargets 加载用于匹配备选地址的ICMP目标数据
+func loadIcmpTargets(ctx context.Context, source string) []model.IcmpTarget {
+	loader := icmpdata.Loader{Source: source}
+	data, err := loader.Load(ctx)
+	if model.EnableLoger {
+		InitLogger()
+		defer Logger.Sync()
+		if err != nil {
+			Logger.Warn(fmt.Sprintf("%v，使用内置快照", err))
+		}
+		Logger.Info(fmt.Sprintf("ICMP目标数据来源: %s，版本: %s，共%d条", data.Origin, data.Version, len(data.Targets)))
+	}
+	// 同步到兼容旧版本的全局变量
+	b, _ := json.Marshal(data.Targets)
+	legacyIcmpMu.Lock()
+	model.CachedIcmpData = string(b)
+	model.CachedIcmpDataFetchTime = time.Now()
+	model.ParsedIcmpTargets = data.Targets
+	legacyIcmpMu.Unlock()
+	return data.Targets
+}
+
+// legacyIcmpMu 保护对 model 包中已弃用的ICMP目标变量的写入
+var legacyIcmpMu sync.Mutex
+
+// BackTraceContext 执行回程路由检测并返回每个目标的结构化结果，
+// 结果按目标列表的顺序排列。ctx 取消或超过 opts.Timeout 时停止所有未完成的追踪，
+// 未完成的目标返回已探测到的部分结果并标记为超时
+func BackTraceContext(ctx context.Context, opts Options) []*TargetResult {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	// 只在有目标需要匹配备选地址时加载，加载同样受整体超时限制
+	icmpTargets := sync.OnceValue(func() []model.IcmpTarget {
+		return loadIcmpTargets(ctx, opts.TargetsSource)
+	})
+	if opts.Tracer == nil && opts.Trace.configured() {
+		opts.Tracer = &Tracer{Config: opts.Trace.Apply(DefaultConfig)}
+		defer opts.Tracer.Close()
+	}
+	targets := selectTargets(opts)
+	totalCount := len(targets)
+	var (
+		s = make([]*TargetResult, totalCount)
+		// 带缓冲，超时后仍未返回的追踪不会阻塞
+		c = make(chan Result, totalCount)
+	)
+	for i := range targets {
+		idx := i
+		go safeTraceCall(func() {
+			c <- Result{idx, traceTarget(ctx, targets[idx], opts, icmpTargets)}
+		})
+	}
+	received := 0
+	done := ctx.Done()
+	var grace <-chan time.Time
+loop:
+	for received < totalCount {
+		select {
+		case o := <-c:
+			s[o.i] = o.r
+			received++
+		case <-done:
+			// 追踪已被取消，给各目标一点时间返回部分结果
+			done = nil
+			grace = time.After(time.Second)
+		case <-grace:
+			break loop
 		}
 	}
-	// 返回完整结果，去掉末尾的换行符
-	result := builder.String()
-	return strings.TrimSuffix(result, "\n")
+	for i, r := range s {
+		if r == nil {
+			// 未能在期限内返回的目标
+			s[i] = newTargetResult(targets[i])
+			s[i].TimedOut = true
+			s[i].Reason = ReasonTimeout
+		}
+	}
+	return s
+}
+
+// BackTraceResult 使用默认超时执行回程路由检测并返回每个目标的结构化结果，
+// 可选的 trace 为追踪参数，最多使用一个
+func BackTraceResult(enableIpv6 bool, trace ...TraceOptions) []*TargetResult {
+	opts := Options{EnableIPv6: enableIpv6}
+	if len(trace) > 0 {
+		opts.Trace = trace[0]
+	}
+	return BackTraceContext(context.Background(), opts)
+}
+
+// BackTrace 执行回程路由检测并返回渲染好的文本结果，可选的 trace 为追踪参数
+func BackTrace(enableIpv6 bool, trace ...TraceOptions) string {
+	return FormatResults(BackTraceResult(enableIpv6, trace...))
 }
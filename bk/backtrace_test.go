@@ -1,7 +1,14 @@
 package backtrace
 
 import (
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/oneclickvirt/backtrace/icmpdata"
+	"github.com/oneclickvirt/backtrace/model"
+	"github.com/oneclickvirt/backtrace/rdns"
+	"github.com/oneclickvirt/backtrace/rules"
 )
 
 //func TestGeneratePrefixMap(t *testing.T) {
@@ -16,5 +23,117 @@ import (
 //}
 
 func TestBackTrace(t *testing.T) {
+	if testing.Short() {
+		t.Skip("requires raw sockets and Internet access")
+	}
 	BackTrace(false)
 }
+
+// asnPath 构造依次经过给定ASN的路径
+func asnPath(asns ...string) []rules.Hop {
+	var path []rules.Hop
+	for i, asn := range asns {
+		path = append(path, rules.Hop{Distance: i + 1, ASN: asn})
+	}
+	return path
+}
+
+func TestClassifyLines(t *testing.T) {
+	cases := []struct {
+		asns []string
+		want []string
+	}{
+		{[]string{"AS4809"}, []string{"CN2GIA"}},
+		{[]string{"AS4134", "AS4809", "AS4134"}, []string{"CN2GT", "163"}},
+		{[]string{"AS4809", "AS4134"}, []string{"CN2", "163"}},
+		{[]string{"AS9808", "AS58453"}, []string{"CMI"}},
+		{nil, nil},
+	}
+	for _, c := range cases {
+		var got []string
+		for _, line := range classifyLines(rules.Default(), asnPath(c.asns...)) {
+			got = append(got, line.Name)
+		}
+		if strings.Join(got, ",") != strings.Join(c.want, ",") {
+			t.Errorf("classifyLines(%v) = %v, want %v", c.asns, got, c.want)
+		}
+	}
+}
+
+func TestFormatDetail(t *testing.T) {
+	r := &TargetResult{
+		Name: "上海电信v4", IP: "202.96.209.133", IPVersion: "v4",
+		Hops: []*HopResult{
+			{Distance: 1, Nodes: []*NodeResult{{IP: "10.0.0.1", RTT: []time.Duration{time.Millisecond, 3 * time.Millisecond},
+				Hostname: "be3360.ccr42.lax01.atlas.cogentco.com", Location: rdns.Decode("be3360.ccr42.lax01.atlas.cogentco.com")}}},
+			{Distance: 3, Nodes: []*NodeResult{{IP: "59.43.1.1", RTT: []time.Duration{150 * time.Millisecond}, ASN: "AS4809", Line: "CN2"}}},
+		},
+		Lines: classifyLines(rules.Default(), asnPath("AS4809")),
+	}
+	lines := strings.Split(FormatDetail(r), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want 4:\n%s", len(lines), strings.Join(lines, "\n"))
+	}
+	if !strings.Contains(lines[1], "1.00 /     2.00 /     3.00 ms") {
+		t.Errorf("unexpected RTT stats: %q", lines[1])
+	}
+	if !strings.HasSuffix(lines[1], "be3360.ccr42.lax01.atlas.cogentco.com [Los Angeles, US]") {
+		t.Errorf("missing hostname and location: %q", lines[1])
+	}
+	if strings.TrimSpace(lines[2]) != "2  *" {
+		t.Errorf("missing hop not rendered as *: %q", lines[2])
+	}
+	if !strings.Contains(lines[3], "AS4809") || !strings.HasSuffix(lines[3], "CN2") {
+		t.Errorf("unexpected hop line: %q", lines[3])
+	}
+}
+
+func TestDestination(t *testing.T) {
+	r := &TargetResult{IP: "2001:db8::1", IPVersion: "v6", Hops: []*HopResult{
+		{Distance: 3, Nodes: []*NodeResult{{IP: "2001:db8:0:0::2"}}},
+		{Distance: 5, Nodes: []*NodeResult{{IP: "2001:db8::7"}}},
+	}}
+	if hop, _ := r.Destination(); hop != nil {
+		t.Errorf("unexpected destination hop %d", hop.Distance)
+	}
+	// 追踪了备选地址时以实际追踪的地址为准，地址按值比较
+	r.TracedIP = "2001:db8:0::2"
+	if hop, n := r.Destination(); hop == nil || hop.Distance != 3 || n.IP != "2001:db8:0:0::2" {
+		t.Errorf("Destination = %+v, %+v", hop, n)
+	}
+}
+
+func TestTryAlternativeIPs(t *testing.T) {
+	loads := 0
+	icmpTargets := func() []model.IcmpTarget {
+		loads++
+		return []model.IcmpTarget{{Province: "上海", ISP: "电信", IPVersion: "v4", IPs: "202.96.209.133, 202.96.209.5"}}
+	}
+	// 目标自带备选地址或缺少省份信息时不加载ICMP目标数据
+	if ips := tryAlternativeIPs(model.Target{FallbackIPs: []string{"192.0.2.1"}}, icmpTargets); len(ips) != 1 || loads != 0 {
+		t.Errorf("fallback IPs = %v, %d loads", ips, loads)
+	}
+	if ips := tryAlternativeIPs(model.Target{ISP: "电信", IPVersion: "v4"}, icmpTargets); ips != nil || loads != 0 {
+		t.Errorf("target without province = %v, %d loads", ips, loads)
+	}
+	target := model.Target{IP: "202.96.209.133", Province: "上海", ISP: "电信", IPVersion: "v4"}
+	if ips := tryAlternativeIPs(target, icmpTargets); strings.Join(ips, ",") != "202.96.209.5" || loads != 1 {
+		t.Errorf("matched IPs = %v, %d loads", ips, loads)
+	}
+}
+
+func TestSnapshotFallbacks(t *testing.T) {
+	// 无法联网时内置快照须能为每个内置目标提供备选地址
+	snapshot := func() []model.IcmpTarget { return icmpdata.Snapshot().Targets }
+	for _, target := range model.DefaultTargets() {
+		ips := tryAlternativeIPs(target, snapshot)
+		if len(ips) == 0 {
+			t.Errorf("%s: no fallback address in the snapshot", target.Name)
+		}
+		for _, ip := range ips {
+			if ip == target.IP {
+				t.Errorf("%s: fallback repeats the primary address %s", target.Name, ip)
+			}
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package backtrace
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	. "github.com/oneclickvirt/defaultset"
+)
+
+// 比较时延劣化的默认阈值
+const (
+	DefaultLatencyThreshold = 20 * time.Millisecond
+	DefaultLatencyRatio     = 0.2
+)
+
+// 目标在两次检测中的比较状态
+const (
+	DiffCompared   = "compared"   // 两次均有完整结果
+	DiffAdded      = "added"      // 仅新一次检测包含该目标
+	DiffRemoved    = "removed"    // 仅旧一次检测包含该目标
+	DiffIncomplete = "incomplete" // 至少一次检测超时或检测不到回程路由，只报告差异不视为显著变化
+)
+
+// DiffOptions 比较两次检测结果的选项
+type DiffOptions struct {
+	LatencyThreshold time.Duration // 端到端时延增加超过该值且增幅超过 LatencyRatio 时视为劣化，为0时使用 DefaultLatencyThreshold
+	LatencyRatio     float64       // 端到端时延的相对增幅阈值，为0时使用 DefaultLatencyRatio
+}
+
+// TargetDiff 同一目标两次检测结果的差异
+type TargetDiff struct {
+	Name             string        `json:"name"`
+	IP               string        `json:"ip"`
+	Status           string        `json:"status"`
+	OldLines         []string      `json:"old_lines"`
+	NewLines         []string      `json:"new_lines"`
+	LinesChanged     bool          `json:"lines_changed"`
+	OldASPath        []string      `json:"old_as_path"`
+	NewASPath        []string      `json:"new_as_path"`
+	ASPathChanged    bool          `json:"as_path_changed"`
+	AddedHops        []string      `json:"added_hops,omitempty"`   // 新一次检测中新出现的节点
+	RemovedHops      []string      `json:"removed_hops,omitempty"` // 新一次检测中消失的节点
+	OldRTT           time.Duration `json:"old_rtt,omitempty"`      // 到目标的平均时延，目标未响应时为0
+	NewRTT           time.Duration `json:"new_rtt,omitempty"`
+	LatencyRegressed bool          `json:"latency_regressed"`
+}
+
+// Significant 返回差异是否需要告警：线路变化、AS路径变化或时延劣化
+func (d *TargetDiff) Significant() bool {
+	return d.Status == DiffCompared && (d.LinesChanged || d.ASPathChanged || d.LatencyRegressed)
+}
+
+// Changed 返回两次检测之间是否存在任何差异
+func (d *TargetDiff) Changed() bool {
+	return d.Status == DiffAdded || d.Status == DiffRemoved || d.LinesChanged || d.ASPathChanged ||
+		d.LatencyRegressed || len(d.AddedHops) > 0 || len(d.RemovedHops) > 0
+}
+
+// DiffResults 按目标名称和地址比较两次检测的结果，顺序与新一次检测一致，
+// 仅旧一次检测包含的目标排在最后
+func DiffResults(old, new []*TargetResult, opts DiffOptions) []*TargetDiff {
+	if opts.LatencyThreshold <= 0 {
+		opts.LatencyThreshold = DefaultLatencyThreshold
+	}
+	if opts.LatencyRatio <= 0 {
+		opts.LatencyRatio = DefaultLatencyRatio
+	}
+	type key struct{ name, ip string }
+	previous := make(map[key]*TargetResult)
+	for _, r := range old {
+		if r != nil {
+			previous[key{r.Name, r.IP}] = r
+		}
+	}
+	var diffs []*TargetDiff
+	for _, r := range new {
+		if r == nil {
+			continue
+		}
+		k := key{r.Name, r.IP}
+		prev, ok := previous[k]
+		if !ok {
+			diffs = append(diffs, &TargetDiff{Name: r.Name, IP: r.IP, Status: DiffAdded, NewLines: lineDescriptions(r.Lines)})
+			continue
+		}
+		delete(previous, k)
+		diffs = append(diffs, diffTarget(prev, r, opts))
+	}
+	for _, r := range old {
+		if r == nil {
+			continue
+		}
+		if _, ok := previous[key{r.Name, r.IP}]; ok {
+			diffs = append(diffs, &TargetDiff{Name: r.Name, IP: r.IP, Status: DiffRemoved, OldLines: lineDescriptions(r.Lines)})
+		}
+	}
+	return diffs
+}
+
+// diffTarget 比较同一目标的两次结果
+func diffTarget(old, new *TargetResult, opts DiffOptions) *TargetDiff {
+	d := &TargetDiff{
+		Name:      new.Name,
+		IP:        new.IP,
+		Status:    DiffCompared,
+		OldLines:  lineDescriptions(old.Lines),
+		NewLines:  lineDescriptions(new.Lines),
+		OldASPath: pathASNs(old.ASPath),
+		NewASPath: pathASNs(new.ASPath),
+	}
+	if incomplete(old) || incomplete(new) {
+		d.Status = DiffIncomplete
+	}
+	d.LinesChanged = lineKeys(old.Lines) != lineKeys(new.Lines)
+	d.ASPathChanged = strings.Join(d.OldASPath, " ") != strings.Join(d.NewASPath, " ")
+	oldNodes, newNodes := nodeIPs(old.Hops), nodeIPs(new.Hops)
+	d.AddedHops = missing(newNodes, oldNodes)
+	d.RemovedHops = missing(oldNodes, newNodes)
+	if _, n := old.Destination(); n != nil {
+		_, d.OldRTT, _ = n.RTTStats()
+	}
+	if _, n := new.Destination(); n != nil {
+		_, d.NewRTT, _ = n.RTTStats()
+	}
+	if d.OldRTT > 0 && d.NewRTT > 0 {
+		increase := d.NewRTT - d.OldRTT
+		d.LatencyRegressed = increase > opts.LatencyThreshold && float64(increase) > float64(d.OldRTT)*opts.LatencyRatio
+	}
+	return d
+}
+
+// incomplete 返回结果是否因超时、检测不到回程路由或内部错误而不可比较
+func incomplete(r *TargetResult) bool {
+	return r.TimedOut || r.Reason == ReasonTimeout || r.Reason == ReasonNoRoute || r.Reason == ReasonInternal
+}
+
+func lineDescriptions(lines []Line) []string {
+	var s []string
+	for _, l := range lines {
+		s = append(s, l.Description)
+	}
+	return s
+}
+
+// lineKeys 将线路归一化为与顺序无关的字符串
+func lineKeys(lines []Line) string {
+	keys := make([]string, 0, len(lines))
+	for _, l := range lines {
+		keys = append(keys, l.Key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+func pathASNs(path []ASSegment) []string {
+	var s []string
+	for _, seg := range path {
+		s = append(s, seg.ASN)
+	}
+	return s
+}
+
+func nodeIPs(hops []*HopResult) []string {
+	var ips []string
+	for _, h := range hops {
+		for _, n := range h.Nodes {
+			ips = append(ips, n.IP)
+		}
+	}
+	return ips
+}
+
+// missing 返回 a 中不在 b 中的地址，保持 a 的顺序
+func missing(a, b []string) []string {
+	seen := make(map[string]bool, len(b))
+	for _, ip := range b {
+		seen[ip] = true
+	}
+	var s []string
+	for _, ip := range a {
+		if !seen[ip] {
+			seen[ip] = true
+			s = append(s, ip)
+		}
+	}
+	return s
+}
+
+// FormatDiffs 将存在差异的目标渲染为文本，显著变化以红色标出
+func FormatDiffs(diffs []*TargetDiff) string {
+	var builder strings.Builder
+	for _, d := range diffs {
+		if !d.Changed() {
+			continue
+		}
+		builder.WriteString(fmt.Sprintf("%v %v", d.Name, d.IP))
+		switch d.Status {
+		case DiffAdded:
+			builder.WriteString(" " + Green("新增目标") + "\n")
+			continue
+		case DiffRemoved:
+			builder.WriteString(" " + Yellow("目标已移除") + "\n")
+			continue
+		case DiffIncomplete:
+			builder.WriteString(" " + Yellow("检测不完整，仅供参考"))
+		}
+		builder.WriteString("\n")
+		highlight := func(s string) string {
+			if d.Status == DiffCompared {
+				return Red(s)
+			}
+			return s
+		}
+		if d.LinesChanged {
+			builder.WriteString("  线路: " + highlight(joinOrNone(d.OldLines, " ")+" -> "+joinOrNone(d.NewLines, " ")) + "\n")
+		}
+		if d.ASPathChanged {
+			builder.WriteString("  AS路径: " + highlight(joinOrNone(d.OldASPath, " -> ")+"  =>  "+joinOrNone(d.NewASPath, " -> ")) + "\n")
+		}
+		if len(d.AddedHops) > 0 {
+			builder.WriteString("  新增节点: " + strings.Join(d.AddedHops, " ") + "\n")
+		}
+		if len(d.RemovedHops) > 0 {
+			builder.WriteString("  消失节点: " + strings.Join(d.RemovedHops, " ") + "\n")
+		}
+		if d.LatencyRegressed {
+			builder.WriteString("  时延: " + highlight(formatMillis(d.OldRTT)+"ms -> "+formatMillis(d.NewRTT)+"ms") + "\n")
+		}
+	}
+	return strings.TrimSuffix(builder.String(), "\n")
+}
+
+func joinOrNone(s []string, sep string) string {
+	if len(s) == 0 {
+		return "无"
+	}
+	return strings.Join(s, sep)
+}
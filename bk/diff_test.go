@@ -0,0 +1,52 @@
+package backtrace
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func diffResult(rtt time.Duration, lines ...Line) *TargetResult {
+	return &TargetResult{
+		Name: "上海电信v4",
+		IP:   "202.96.209.133",
+		Hops: []*HopResult{
+			{Distance: 2, Nodes: []*NodeResult{{IP: "59.43.1.1", RTT: []time.Duration{rtt / 2}}}},
+			{Distance: 3, Nodes: []*NodeResult{{IP: "202.96.209.133", RTT: []time.Duration{rtt}}}},
+		},
+		ASPath: []ASSegment{{ASN: "AS4809"}},
+		Lines:  lines,
+	}
+}
+
+func TestDiffResults(t *testing.T) {
+	gia := Line{Key: "AS4809a", Description: "电信CN2GIA [精品线路]"}
+	ct163 := Line{Key: "AS4134", Description: "电信163 [普通线路]"}
+	old := []*TargetResult{diffResult(150*time.Millisecond, gia), {Name: "旧目标", IP: "192.0.2.1"}}
+
+	// 时延小幅波动不算显著变化
+	diffs := DiffResults(old, []*TargetResult{diffResult(160*time.Millisecond, gia)}, DiffOptions{})
+	if len(diffs) != 2 || diffs[0].Changed() || diffs[0].Significant() || diffs[1].Status != DiffRemoved {
+		t.Fatalf("unexpected diffs %+v %+v", diffs[0], diffs[1])
+	}
+
+	moved := diffResult(200*time.Millisecond, ct163)
+	moved.Hops[0].Nodes[0].IP = "202.97.1.1"
+	moved.ASPath = []ASSegment{{ASN: "AS4134"}}
+	d := DiffResults(old, []*TargetResult{moved}, DiffOptions{})[0]
+	if !d.Significant() || !d.LinesChanged || !d.ASPathChanged || !d.LatencyRegressed {
+		t.Errorf("unexpected diff %+v", d)
+	}
+	if strings.Join(d.AddedHops, " ") != "202.97.1.1" || strings.Join(d.RemovedHops, " ") != "59.43.1.1" {
+		t.Errorf("hops added %v, removed %v", d.AddedHops, d.RemovedHops)
+	}
+	if text := FormatDiffs([]*TargetDiff{d}); !strings.Contains(text, "电信CN2GIA [精品线路] -> 电信163 [普通线路]") {
+		t.Errorf("FormatDiffs = %q", text)
+	}
+
+	// 超时的检测只报告差异
+	moved.TimedOut = true
+	if d := DiffResults(old, []*TargetResult{moved}, DiffOptions{})[0]; d.Status != DiffIncomplete || d.Significant() {
+		t.Errorf("incomplete diff %+v", d)
+	}
+}
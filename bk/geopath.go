@@ -0,0 +1,88 @@
+package backtrace
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/oneclickvirt/backtrace/geoip"
+)
+
+// GeoSegment 回程路径上连续位于同一国家或地区的一段节点，相邻两段的交界即路径出入境的位置
+type GeoSegment struct {
+	Country     string `json:"country"`
+	FirstHop    int    `json:"first_hop"`              // 该段第一个节点的跳数
+	LastHop     int    `json:"last_hop"`               // 该段最后一个节点的跳数
+	Ingress     string `json:"ingress"`                // 进入该国家的第一个节点
+	Egress      string `json:"egress"`                 // 离开该国家前的最后一个节点
+	IngressCity string `json:"ingress_city,omitempty"` // 入境节点所在城市
+	EgressCity  string `json:"egress_city,omitempty"`  // 出境节点所在城市
+}
+
+// annotateGeo 使用离线地理位置数据库为每个节点标注国家、城市及坐标
+func annotateGeo(hops []*HopResult, db *geoip.DB) {
+	if db == nil {
+		return
+	}
+	for _, h := range hops {
+		for _, n := range h.Nodes {
+			addr, err := netip.ParseAddr(n.IP)
+			if err != nil {
+				continue
+			}
+			if loc, ok := db.Lookup(addr); ok {
+				n.Geo = loc
+			}
+		}
+	}
+}
+
+// buildGeoPath 按跳数顺序将节点归并为国家段，没有国家信息的节点（如内网地址）不会打断所在的段
+func buildGeoPath(hops []*HopResult) []GeoSegment {
+	var path []GeoSegment
+	for _, h := range hops {
+		for _, n := range h.Nodes {
+			if n.Geo == nil || n.Geo.Country == "" {
+				continue
+			}
+			last := len(path) - 1
+			if last < 0 || path[last].Country != n.Geo.Country {
+				path = append(path, GeoSegment{
+					Country:     n.Geo.Country,
+					FirstHop:    h.Distance,
+					Ingress:     n.IP,
+					IngressCity: n.Geo.City,
+				})
+				last++
+			}
+			seg := &path[last]
+			seg.LastHop = h.Distance
+			seg.Egress = n.IP
+			seg.EgressCity = n.Geo.City
+		}
+	}
+	return path
+}
+
+// formatGeoPath 将地理路径渲染为一行，如 US 1-6 (Los Angeles) -> CN 7-12 (Shanghai-Hangzhou)
+func formatGeoPath(path []GeoSegment) string {
+	parts := make([]string, 0, len(path))
+	for _, seg := range path {
+		text := fmt.Sprintf("%s %d", seg.Country, seg.FirstHop)
+		if seg.LastHop != seg.FirstHop {
+			text += fmt.Sprintf("-%d", seg.LastHop)
+		}
+		cities := seg.IngressCity
+		if seg.EgressCity != "" && seg.EgressCity != seg.IngressCity {
+			if cities != "" {
+				cities += "-"
+			}
+			cities += seg.EgressCity
+		}
+		if cities != "" {
+			text += " (" + cities + ")"
+		}
+		parts = append(parts, text)
+	}
+	return strings.Join(parts, " -> ")
+}
@@ -0,0 +1,41 @@
+package backtrace
+
+import (
+	"testing"
+
+	"github.com/oneclickvirt/backtrace/geoip"
+)
+
+func TestBuildGeoPath(t *testing.T) {
+	geo := func(country, city string) *geoip.Location {
+		return &geoip.Location{Country: country, City: city}
+	}
+	hops := []*HopResult{
+		{Distance: 1, Nodes: []*NodeResult{{IP: "10.0.0.1"}}},
+		{Distance: 2, Nodes: []*NodeResult{{IP: "198.51.100.1", Geo: geo("US", "Los Angeles")}}},
+		{Distance: 3, Nodes: []*NodeResult{{IP: "198.51.100.2", Geo: geo("US", "Los Angeles")}}},
+		{Distance: 4, Nodes: []*NodeResult{{IP: "10.1.1.1"}}},
+		{Distance: 5, Nodes: []*NodeResult{{IP: "202.97.1.1", Geo: geo("CN", "Shanghai")}}},
+		{Distance: 6, Nodes: []*NodeResult{{IP: "202.97.2.2", Geo: geo("CN", "")}}},
+		{Distance: 7, Nodes: []*NodeResult{{IP: "115.236.12.1", Geo: geo("CN", "Hangzhou")}}},
+	}
+	path := buildGeoPath(hops)
+	want := []GeoSegment{
+		{Country: "US", FirstHop: 2, LastHop: 3, Ingress: "198.51.100.1", Egress: "198.51.100.2", IngressCity: "Los Angeles", EgressCity: "Los Angeles"},
+		{Country: "CN", FirstHop: 5, LastHop: 7, Ingress: "202.97.1.1", Egress: "115.236.12.1", IngressCity: "Shanghai", EgressCity: "Hangzhou"},
+	}
+	if len(path) != len(want) {
+		t.Fatalf("got %+v", path)
+	}
+	for i := range want {
+		if path[i] != want[i] {
+			t.Errorf("segment %d = %+v, want %+v", i, path[i], want[i])
+		}
+	}
+	if got := formatGeoPath(path); got != "US 2-3 (Los Angeles) -> CN 5-7 (Shanghai-Hangzhou)" {
+		t.Errorf("formatGeoPath = %q", got)
+	}
+	if path := buildGeoPath(hops[:1]); path != nil {
+		t.Errorf("path without locations = %+v", path)
+	}
+}
@@ -0,0 +1,56 @@
+package backtrace
+
+import (
+	"net"
+	"time"
+)
+
+// DefaultAttempts 每个目标默认并发追踪的次数
+const DefaultAttempts = 3
+
+// TraceOptions 单次检测的追踪参数，零值字段使用 DefaultConfig 及 DefaultAttempts 中的值
+type TraceOptions struct {
+	MaxHops  int           // 最后一个探测的TTL，即探测到的最远跳数
+	Timeout  time.Duration // 发出全部探测后等待回复的时间
+	Delay    time.Duration // 相邻两个探测的间隔
+	Count    int           // 每跳的探测次数
+	Attempts int           // 每个目标并发追踪的次数
+	FirstTTL int           // 首个探测的TTL，为1时探测本地网关
+	Source   net.IP        // 探测报文的源地址
+}
+
+// Apply 用非零字段覆盖 config 中对应的参数并返回结果，config 本身不会被修改
+func (o TraceOptions) Apply(config Config) Config {
+	if o.MaxHops > 0 {
+		config.MaxHops = o.MaxHops
+	}
+	if o.Timeout > 0 {
+		config.Timeout = o.Timeout
+	}
+	if o.Delay > 0 {
+		config.Delay = o.Delay
+	}
+	if o.Count > 0 {
+		config.Count = o.Count
+	}
+	if o.FirstTTL > 0 {
+		config.FirstTTL = o.FirstTTL
+	}
+	if o.Source != nil {
+		config.Addr = &net.IPAddr{IP: o.Source}
+	}
+	return config
+}
+
+// configured 返回是否设置了 Attempts 以外需要由Tracer执行的参数
+func (o TraceOptions) configured() bool {
+	return o.MaxHops > 0 || o.Timeout > 0 || o.Delay > 0 || o.Count > 0 || o.FirstTTL > 0 || o.Source != nil
+}
+
+// attempts 返回每个目标并发追踪的次数
+func (o TraceOptions) attempts() int {
+	if o.Attempts > 0 {
+		return o.Attempts
+	}
+	return DefaultAttempts
+}
@@ -0,0 +1,25 @@
+package backtrace
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTraceOptionsApply(t *testing.T) {
+	defaults := DefaultConfig
+	config := TraceOptions{MaxHops: 30, Timeout: 2 * time.Second, Source: net.ParseIP("192.0.2.1")}.Apply(DefaultConfig)
+	if config.MaxHops != 30 || config.Timeout != 2*time.Second || config.Addr == nil || !config.Addr.IP.Equal(net.ParseIP("192.0.2.1")) {
+		t.Errorf("Apply = %+v", config)
+	}
+	// 未设置的参数保持默认值
+	if config.Delay != defaults.Delay || config.Count != defaults.Count || config.firstTTL() != DefaultFirstTTL {
+		t.Errorf("Apply changed unset fields: %+v", config)
+	}
+	if DefaultConfig.MaxHops != defaults.MaxHops || DefaultConfig.Addr != nil {
+		t.Errorf("Apply modified DefaultConfig: %+v", DefaultConfig)
+	}
+	if (TraceOptions{Attempts: 5}).configured() || (TraceOptions{}).attempts() != DefaultAttempts {
+		t.Error("Attempts should not require a dedicated Tracer")
+	}
+}
@@ -0,0 +1,373 @@
+package backtrace
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/oneclickvirt/backtrace/asndb"
+	"github.com/oneclickvirt/backtrace/geoip"
+	"github.com/oneclickvirt/backtrace/rdns"
+	"github.com/oneclickvirt/backtrace/rules"
+	. "github.com/oneclickvirt/defaultset"
+)
+
+// 检测失败的原因
+const (
+	ReasonNoRoute     = "no_route"       // 检测不到回程路由节点的IP地址
+	ReasonNoASN       = "no_asn"         // 回程路由节点中没有可识别ASN的地址
+	ReasonNoKnownLine = "no_known_line"  // 检测不到已知线路的ASN
+	ReasonTimeout     = "timeout"        // 超时前未获得任何回程路由节点
+	ReasonInternal    = "internal_error" // 检测过程中发生内部错误（panic），详情见 Error
+)
+
+// TargetResult 单个目标的回程路由检测结果
+type TargetResult struct {
+	Name      string       `json:"name"`
+	IP        string       `json:"ip"`
+	ISP       string       `json:"isp"`
+	City      string       `json:"city"`
+	IPVersion string       `json:"ip_version"`
+	TracedIP  string       `json:"traced_ip,omitempty"` // 实际追踪的地址，原始地址不可用时为备选地址
+	Hops      []*HopResult `json:"hops"`
+	ASNs      []string     `json:"asns"`
+	ASPath    []ASSegment  `json:"as_path,omitempty"`  // 按跳数顺序排列的AS段
+	GeoPath   []GeoSegment `json:"geo_path,omitempty"` // 按跳数顺序排列的国家段，需要地理位置数据库
+	Lines     []Line       `json:"lines"`
+	Reason    string       `json:"reason,omitempty"`
+	Error     string       `json:"error,omitempty"` // Reason 为 ReasonInternal 时的错误详情
+	TimedOut  bool         `json:"timed_out"`       // 追踪因超时或取消而提前结束，结果可能不完整
+}
+
+// HopResult 合并后的单跳信息
+type HopResult struct {
+	Distance int           `json:"distance"`
+	Nodes    []*NodeResult `json:"nodes"`
+	Loss     float64       `json:"loss"` // 所有成功追踪中该跳未收到响应的探测包比例，0~1
+}
+
+// NodeResult 单跳中响应的节点
+type NodeResult struct {
+	IP        string          `json:"ip"`
+	RTT       []time.Duration `json:"rtt"`
+	ASN       string          `json:"asn,omitempty"`        // 内置前缀表识别出的线路ASN
+	OriginASN uint32          `json:"origin_asn,omitempty"` // 离线数据库中的源ASN
+	ASName    string          `json:"as_name,omitempty"`    // 离线数据库中的AS名称
+	Line      string          `json:"line,omitempty"`       // 节点ASN对应的线路简称
+	Hostname  string          `json:"hostname,omitempty"`   // 反向解析得到的主机名
+	Location  *rdns.Hint      `json:"location,omitempty"`   // 从主机名中识别出的地点、路由器及接口
+	Geo       *geoip.Location `json:"geo,omitempty"`        // 地理位置数据库中的国家、城市及坐标
+}
+
+// Line 识别出的线路
+type Line struct {
+	Key         string `json:"key"`               // 命中规则的键，如 AS4809a
+	ASN         string `json:"asn"`               // 线路所属ASN，如 AS4809
+	Name        string `json:"name"`              // 线路简称，如 CN2GIA
+	Description string `json:"description"`       // 线路描述，如 电信CN2GIA [精品线路]
+	Tier        string `json:"tier"`              // 线路等级，见 rules.TierPremium 等
+	PartOf      string `json:"part_of,omitempty"` // 所属组合线路的键，如CN2GT中的163线路为 AS4809b
+}
+
+// annotateLoss 根据所有成功追踪中各跳收到的响应数计算丢包率，
+// probes 为单次追踪向每一跳发送的探测包数量
+func annotateLoss(hops []*HopResult, allHops [][]*Hop, probes int) {
+	sent := probes * len(allHops)
+	if sent <= 0 {
+		return
+	}
+	received := make(map[int]int)
+	for _, trace := range allHops {
+		for _, h := range trace {
+			for _, n := range h.Nodes {
+				if n != nil {
+					received[h.Distance] += len(n.RTT)
+				}
+			}
+		}
+	}
+	for _, h := range hops {
+		// 目的节点会并入更大TTL的响应，收到的数量可能超过发送数量
+		got := received[h.Distance]
+		if got > sent {
+			got = sent
+		}
+		h.Loss = 1 - float64(got)/float64(sent)
+	}
+}
+
+// newHopResults 将合并后的hops转换为结果结构
+func newHopResults(hops []*Hop) []*HopResult {
+	results := make([]*HopResult, 0, len(hops))
+	for _, h := range hops {
+		hr := &HopResult{Distance: h.Distance}
+		for _, n := range h.Nodes {
+			if n == nil || n.IP == nil {
+				continue
+			}
+			ip := n.IP.String()
+			hr.Nodes = append(hr.Nodes, &NodeResult{
+				IP:  ip,
+				RTT: append([]time.Duration(nil), n.RTT...),
+				ASN: lookupASN(ip),
+			})
+		}
+		results = append(results, hr)
+	}
+	return results
+}
+
+// annotateOriginASN 使用离线数据库为每个节点标注源ASN及名称
+func annotateOriginASN(hops []*HopResult, db *asndb.DB) {
+	if db == nil {
+		return
+	}
+	for _, h := range hops {
+		for _, n := range h.Nodes {
+			addr, err := netip.ParseAddr(n.IP)
+			if err != nil {
+				continue
+			}
+			if rec, ok := db.Lookup(addr); ok {
+				n.OriginASN = rec.ASN
+				n.ASName = rec.Name
+			}
+		}
+	}
+}
+
+// annotateHostnames 反向解析每个节点的地址，并从主机名中识别位置信息
+func annotateHostnames(ctx context.Context, hops []*HopResult, r *rdns.Resolver) {
+	if r == nil {
+		return
+	}
+	var ips []string
+	for _, h := range hops {
+		for _, n := range h.Nodes {
+			ips = append(ips, n.IP)
+		}
+	}
+	names := r.LookupAll(ctx, ips)
+	for _, h := range hops {
+		for _, n := range h.Nodes {
+			if name, ok := names[n.IP]; ok {
+				n.Hostname = name
+				n.Location = rdns.Decode(name)
+			}
+		}
+	}
+}
+
+// annotateLines 为识别出线路ASN的节点标注线路简称
+func annotateLines(hops []*HopResult, rs *rules.RuleSet) {
+	for _, h := range hops {
+		for _, n := range h.Nodes {
+			n.Line = rs.Label(n.ASN)
+		}
+	}
+}
+
+// classifyLines 按规则识别路径经过的线路
+func classifyLines(rs *rules.RuleSet, path []rules.Hop) []Line {
+	matched := rs.Classify(path)
+	var lines []Line
+	for _, r := range matched {
+		line := Line{
+			Key:         r.Key,
+			ASN:         r.ASN,
+			Name:        r.Name,
+			Description: r.Description,
+			Tier:        r.Tier,
+		}
+		for _, o := range matched {
+			if o != r && o.Combines(r.ASN) {
+				line.PartOf = o.Key
+				break
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// rulePath 将逐跳结果按顺序转换为规则引擎的输入，节点ASN与AS路径一致
+func rulePath(hops []*HopResult) []rules.Hop {
+	var path []rules.Hop
+	for _, h := range hops {
+		for _, n := range h.Nodes {
+			addr, _ := netip.ParseAddr(n.IP)
+			path = append(path, rules.Hop{Distance: h.Distance, IP: addr, ASN: nodeASN(n)})
+		}
+	}
+	return path
+}
+
+// FormatResult 将单个目标的检测结果渲染为带颜色的文本
+func FormatResult(r *TargetResult) string {
+	if r == nil {
+		return ""
+	}
+	ipWidth := 15
+	noAddress := "检测不到回程路由节点的IPV4地址"
+	if r.IPVersion == "v6" {
+		ipWidth = 24
+		noAddress = "检测不到回程路由节点的IPV6地址"
+	}
+	switch r.Reason {
+	case ReasonTimeout:
+		return fmt.Sprintf("%v %-*s %v", r.Name, ipWidth, r.IP, Red("检测超时"))
+	case ReasonNoRoute:
+		return fmt.Sprintf("%v %-*s %v", r.Name, ipWidth, r.IP, Red("检测不到回程路由节点的IP地址"))
+	case ReasonNoASN:
+		return fmt.Sprintf("%v %-*s %v", r.Name, ipWidth, r.IP, Red(noAddress))
+	case ReasonInternal:
+		return fmt.Sprintf("%v %-*s %v", r.Name, ipWidth, r.IP, Red("检测出错: "+r.Error))
+	}
+	text := fmt.Sprintf("%v %-24s ", r.Name, r.IP)
+	for _, line := range r.Lines {
+		switch line.Tier {
+		case rules.TierPremium:
+			text += DarkGreen(line.Description) + " "
+		case rules.TierGood:
+			text += Green(line.Description) + " "
+		default:
+			text += White(line.Description) + " "
+		}
+	}
+	if len(r.Lines) == 0 {
+		text += fmt.Sprintf("%v", Red("检测不到已知线路的ASN"))
+	}
+	return text
+}
+
+// FormatResults 将多个目标的检测结果按顺序渲染为文本，每个目标一行
+func FormatResults(results []*TargetResult) string {
+	var builder strings.Builder
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+		builder.WriteString(FormatResult(r))
+		builder.WriteString("\n")
+	}
+	return strings.TrimSuffix(builder.String(), "\n")
+}
+
+// RTTStats 返回节点的最小、平均和最大往返时间，没有样本时均为0
+func (n *NodeResult) RTTStats() (min, avg, max time.Duration) {
+	if len(n.RTT) == 0 {
+		return 0, 0, 0
+	}
+	var sum time.Duration
+	min, max = n.RTT[0], n.RTT[0]
+	for _, rtt := range n.RTT {
+		if rtt < min {
+			min = rtt
+		}
+		if rtt > max {
+			max = rtt
+		}
+		sum += rtt
+	}
+	return min, sum / time.Duration(len(n.RTT)), max
+}
+
+// Destination 返回实际追踪的地址所在的跳及节点，目标未响应时返回nil
+func (r *TargetResult) Destination() (*HopResult, *NodeResult) {
+	ip := r.TracedIP
+	if ip == "" {
+		// 未记录实际追踪地址的旧结果
+		ip = r.IP
+	}
+	dst, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, nil
+	}
+	dst = dst.Unmap()
+	for i := len(r.Hops) - 1; i >= 0; i-- {
+		for _, n := range r.Hops[i].Nodes {
+			if addr, err := netip.ParseAddr(n.IP); err == nil && addr.Unmap() == dst {
+				return r.Hops[i], n
+			}
+		}
+	}
+	return nil, nil
+}
+
+// formatMillis 以毫秒为单位格式化时间
+func formatMillis(d time.Duration) string {
+	return fmt.Sprintf("%.2f", float64(d)/float64(time.Millisecond))
+}
+
+// FormatDetail 渲染单个目标的逐跳详细路由，首行为线路结论，
+// 之后每行为一个响应节点的跳数、地址、最小/平均/最大延迟、ASN、线路及反向解析的主机名和位置，最后为AS路径及地理路径
+func FormatDetail(r *TargetResult) string {
+	if r == nil {
+		return ""
+	}
+	var builder strings.Builder
+	builder.WriteString(FormatResult(r))
+	builder.WriteString("\n")
+	next := 1
+	for _, h := range r.Hops {
+		// 没有响应的跳数显示为 *
+		for ; next < h.Distance; next++ {
+			builder.WriteString(fmt.Sprintf("  %2d  %s\n", next, "*"))
+		}
+		next = h.Distance + 1
+		if len(h.Nodes) == 0 {
+			builder.WriteString(fmt.Sprintf("  %2d  %s\n", h.Distance, "*"))
+			continue
+		}
+		for i, n := range h.Nodes {
+			distance := fmt.Sprintf("%2d", h.Distance)
+			if i > 0 {
+				distance = "  "
+			}
+			min, avg, max := n.RTTStats()
+			asn := n.ASN
+			if asn == "" && n.OriginASN != 0 {
+				asn = fmt.Sprintf("AS%d", n.OriginASN)
+			}
+			label := n.Line
+			if label == "" {
+				label = n.ASName
+			}
+			line := fmt.Sprintf("  %s  %-39s %8s / %8s / %8s ms  %-8s %s",
+				distance, n.IP, formatMillis(min), formatMillis(avg), formatMillis(max), asn, label)
+			if n.Hostname != "" {
+				line += "  " + n.Hostname
+			}
+			// 路由器命名中的地点通常比地理位置数据库更准确
+			loc := n.Location.Location()
+			if loc == "" {
+				loc = n.Geo.String()
+			}
+			if loc != "" {
+				line += " [" + loc + "]"
+			}
+			builder.WriteString(line + "\n")
+		}
+	}
+	if len(r.ASPath) > 0 {
+		builder.WriteString("  AS路径: " + formatASPath(r.ASPath) + "\n")
+	}
+	if len(r.GeoPath) > 0 {
+		builder.WriteString("  地理路径: " + formatGeoPath(r.GeoPath) + "\n")
+	}
+	return strings.TrimSuffix(builder.String(), "\n")
+}
+
+// FormatDetails 按顺序渲染多个目标的逐跳详细路由，目标之间以空行分隔
+func FormatDetails(results []*TargetResult) string {
+	var parts []string
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+		parts = append(parts, FormatDetail(r))
+	}
+	return strings.Join(parts, "\n\n")
+}
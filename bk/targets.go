@@ -0,0 +1,172 @@
+package backtrace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/oneclickvirt/backtrace/model"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadTargets 从 JSON 或 YAML 文件加载检测目标，扩展名为 .yaml/.yml 时按 YAML 解析，否则按 JSON 解析
+func LoadTargets(path string) ([]model.Target, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取目标文件失败: %w", err)
+	}
+	format := "json"
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		format = "yaml"
+	}
+	return ParseTargets(data, format)
+}
+
+// ParseTargets 解析 format 格式（json 或 yaml）的目标列表并校验每个目标
+func ParseTargets(data []byte, format string) ([]model.Target, error) {
+	var targets []model.Target
+	var err error
+	switch format {
+	case "json":
+		err = json.Unmarshal(data, &targets)
+	case "yaml":
+		err = yaml.Unmarshal(data, &targets)
+	default:
+		return nil, fmt.Errorf("unsupported target format: %s", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析目标列表失败: %w", err)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("目标列表为空")
+	}
+	for i := range targets {
+		if err := normalizeTarget(&targets[i]); err != nil {
+			return nil, fmt.Errorf("第%d个目标无效: %w", i+1, err)
+		}
+	}
+	return targets, nil
+}
+
+// normalizeTarget 校验目标地址，补全缺省的名称和IP版本
+func normalizeTarget(t *model.Target) error {
+	ip := net.ParseIP(strings.TrimSpace(t.IP))
+	if ip == nil {
+		return fmt.Errorf("invalid IP address: %q", t.IP)
+	}
+	t.IP = ip.String()
+	version := "v6"
+	if ip.To4() != nil {
+		version = "v4"
+	}
+	switch t.IPVersion {
+	case "":
+		t.IPVersion = version
+	case version:
+	default:
+		return fmt.Errorf("ip_version %q does not match %s", t.IPVersion, t.IP)
+	}
+	for _, fallback := range t.FallbackIPs {
+		if ip := net.ParseIP(strings.TrimSpace(fallback)); ip == nil || (ip.To4() != nil) != (version == "v4") {
+			return fmt.Errorf("invalid fallback IP address: %q", fallback)
+		}
+	}
+	if t.Name == "" {
+		t.Name = t.IP
+	}
+	return nil
+}
+
+// 解析主机名时选择的地址族
+const (
+	ResolveAuto = "auto" // 优先使用A记录，没有时使用AAAA记录
+	ResolveIPv4 = "4"    // 只使用A记录
+	ResolveIPv6 = "6"    // 只使用AAAA记录
+	ResolveAll  = "all"  // A和AAAA记录各生成一个目标
+)
+
+// Resolver 将主机名解析为地址，*net.Resolver 满足该接口
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// ResolveTargets 将主机名或IP地址列表转换为检测目标，family 为 ResolveAuto、ResolveIPv4、ResolveIPv6 或 ResolveAll。
+// 每个地址族取第一个地址为主地址，其余最多3个作为备选地址；resolver 为nil时使用 net.DefaultResolver
+func ResolveTargets(ctx context.Context, hosts []string, family string, resolver Resolver) ([]model.Target, error) {
+	switch family {
+	case ResolveAuto, ResolveIPv4, ResolveIPv6, ResolveAll:
+	default:
+		return nil, fmt.Errorf("unsupported address family: %s", family)
+	}
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	var targets []model.Target
+	for _, host := range hosts {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		// IP地址直接作为目标，不受地址族限制
+		if ip := net.ParseIP(host); ip != nil {
+			targets = append(targets, model.Target{IP: ip.String()})
+			continue
+		}
+		addrs, err := resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("解析 %s 失败: %w", host, err)
+		}
+		var v4, v6 []string
+		for _, addr := range addrs {
+			if addr.IP.To4() != nil {
+				v4 = append(v4, addr.IP.String())
+			} else {
+				v6 = append(v6, addr.IP.String())
+			}
+		}
+		var groups [][]string
+		switch family {
+		case ResolveAuto:
+			if len(v4) > 0 {
+				groups = append(groups, v4)
+			} else {
+				groups = append(groups, v6)
+			}
+		case ResolveIPv4:
+			groups = append(groups, v4)
+		case ResolveIPv6:
+			groups = append(groups, v6)
+		case ResolveAll:
+			groups = append(groups, v4, v6)
+		}
+		found := false
+		for _, ips := range groups {
+			if len(ips) == 0 {
+				continue
+			}
+			found = true
+			fallback := ips[1:]
+			if len(fallback) > 3 {
+				fallback = fallback[:3]
+			}
+			targets = append(targets, model.Target{Name: host, IP: ips[0], FallbackIPs: fallback})
+		}
+		if !found {
+			return nil, fmt.Errorf("%s 没有符合地址族 %s 的记录", host, family)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("目标列表为空")
+	}
+	for i := range targets {
+		if err := normalizeTarget(&targets[i]); err != nil {
+			return nil, fmt.Errorf("目标 %s 无效: %w", targets[i].Name, err)
+		}
+	}
+	return targets, nil
+}
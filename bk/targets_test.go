@@ -0,0 +1,115 @@
+package backtrace
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/oneclickvirt/backtrace/model"
+)
+
+func TestDefaultTargets(t *testing.T) {
+	targets := model.DefaultTargets()
+	if len(targets) == 0 {
+		t.Fatal("no default targets")
+	}
+	for i := range targets {
+		if err := normalizeTarget(&targets[i]); err != nil {
+			t.Errorf("default target %q: %v", targets[i].Name, err)
+		}
+		if targets[i].ISP == "" || targets[i].Province == "" {
+			t.Errorf("default target %q lacks isp or province", targets[i].Name)
+		}
+	}
+}
+
+func TestParseTargets(t *testing.T) {
+	yamlData := []byte(`
+- name: 杭州电信v4
+  ip: 115.236.12.1
+  isp: 电信
+  province: 浙江
+  city: 杭州
+  fallback_ips: [60.191.244.5]
+- ip: 2408:8756:f50:1001::c
+`)
+	targets, err := ParseTargets(yamlData, "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 2 {
+		t.Fatalf("got %d targets, want 2", len(targets))
+	}
+	if targets[0].IPVersion != "v4" || targets[0].FallbackIPs[0] != "60.191.244.5" {
+		t.Errorf("unexpected first target: %+v", targets[0])
+	}
+	if targets[1].IPVersion != "v6" || targets[1].Name != "2408:8756:f50:1001::c" {
+		t.Errorf("unexpected second target: %+v", targets[1])
+	}
+	invalid := [][]byte{
+		[]byte(`[]`),
+		[]byte(`[{"ip": "not-an-ip"}]`),
+		[]byte(`[{"ip": "1.1.1.1", "ip_version": "v6"}]`),
+		[]byte(`[{"ip": "1.1.1.1", "fallback_ips": ["::1"]}]`),
+	}
+	for _, data := range invalid {
+		if _, err := ParseTargets(data, "json"); err == nil {
+			t.Errorf("ParseTargets(%s) succeeded, want error", data)
+		}
+	}
+}
+
+// staticResolver 从固定的表中解析主机名
+type staticResolver map[string][]string
+
+func (r staticResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := r[host]
+	if !ok {
+		return nil, fmt.Errorf("no such host %s", host)
+	}
+	var addrs []net.IPAddr
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+func TestResolveTargets(t *testing.T) {
+	resolver := staticResolver{
+		"dual.example":   {"2001:db8::1", "192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4", "192.0.2.5"},
+		"v6only.example": {"2001:db8::2"},
+	}
+	ctx := context.Background()
+	targets, err := ResolveTargets(ctx, []string{"dual.example", " 198.51.100.1 ", "v6only.example"}, ResolveAuto, resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"dual.example 192.0.2.1 v4", "198.51.100.1 198.51.100.1 v4", "v6only.example 2001:db8::2 v6"}
+	if len(targets) != len(want) {
+		t.Fatalf("got %+v", targets)
+	}
+	for i, w := range want {
+		if got := targets[i].Name + " " + targets[i].IP + " " + targets[i].IPVersion; got != w {
+			t.Errorf("target %d = %s, want %s", i, got, w)
+		}
+	}
+	// 其余地址最多3个作为备选
+	if fb := targets[0].FallbackIPs; len(fb) != 3 || fb[0] != "192.0.2.2" {
+		t.Errorf("fallback IPs = %v", fb)
+	}
+
+	targets, err = ResolveTargets(ctx, []string{"dual.example"}, ResolveAll, resolver)
+	if err != nil || len(targets) != 2 || targets[1].IP != "2001:db8::1" {
+		t.Errorf("ResolveAll: %+v, %v", targets, err)
+	}
+	if _, err := ResolveTargets(ctx, []string{"v6only.example"}, ResolveIPv4, resolver); err == nil {
+		t.Error("host without A records did not fail")
+	}
+	if _, err := ResolveTargets(ctx, []string{"missing.example"}, ResolveAuto, resolver); err == nil {
+		t.Error("unresolvable host did not fail")
+	}
+	if _, err := ResolveTargets(ctx, []string{"dual.example"}, "5", resolver); err == nil {
+		t.Error("invalid family did not fail")
+	}
+}
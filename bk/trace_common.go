@@ -4,9 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand"
 	"net"
 	"sort"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -22,7 +22,7 @@ import (
 var DefaultConfig = Config{
 	Delay:    50 * time.Millisecond,
 	Timeout:  500 * time.Millisecond,
-	MaxHops:  15,
+	MaxHops:  16, // TTL 2..16, the range probed before FirstTTL was configurable
 	Count:    1,
 	Networks: []string{"ip4:icmp", "ip4:ip", "ip6:ipv6-icmp", "ip6:ip"},
 }
@@ -40,21 +40,41 @@ type Config struct {
 	Count    int
 	Networks []string
 	Addr     *net.IPAddr
+	// Protocol is the probe protocol: ProbeICMP (default), ProbeUDP or ProbeTCP.
+	Protocol string
+	// Port is the destination port of TCP probes and the base destination port of UDP probes.
+	// Zero means DefaultTCPPort or DefaultUDPPort.
+	Port int
+	// Paris keeps the flow identifier (ports, ICMP identifier and checksum) of probes
+	// constant across TTLs, so that per-flow load balancers forward them along one path.
+	Paris bool
+	// Flows enables multipath discovery when greater than 1: every TTL is probed with
+	// Flows distinct Paris flows, so each Hop lists the nodes of all ECMP branches.
+	Flows int
+	// FirstTTL is the TTL of the first probe. Zero means DefaultFirstTTL.
+	FirstTTL int
 }
 
+// DefaultFirstTTL is the TTL of the first probe when Config.FirstTTL is zero.
+// Hop 1 is usually the local gateway and is skipped.
+const DefaultFirstTTL = 2
+
 // Tracer is a traceroute tool based on raw IP packets.
 // It can handle multiple sessions simultaneously.
 type Tracer struct {
 	Config
-
-	once     sync.Once
-	conn     *net.IPConn      // Ipv4连接
-	ipv6conn *ipv6.PacketConn // IPv6连接
-	err      error
-
-	mu   sync.RWMutex
-	sess map[string][]*Session
-	seq  uint32
+	// Transport sends probes and receives replies. Nil means raw sockets opened
+	// according to Config when the first session is created.
+	Transport Transport
+
+	once    sync.Once
+	srcPort uint16 // UDP/TCP探测的源端口
+	err     error
+
+	mu       sync.RWMutex
+	sess     map[string][]*Session
+	seq      uint32
+	srcAddrs map[string]net.IP // 目标地址 -> 本地源地址
 }
 
 // Trace starts sending IP packets increasing TTL until MaxHops and calls h for each reply.
@@ -70,20 +90,22 @@ func (t *Tracer) Trace(ctx context.Context, ip net.IP, h func(reply *Reply)) err
 
 	max := t.MaxHops
 	for n := 0; n < t.Count; n++ {
-		for ttl := 1; ttl <= t.MaxHops && ttl <= max; ttl++ {
-			err = sess.Ping(ttl)
-			if err != nil {
-				return err
-			}
-			select {
-			case <-delay.C:
-			case r := <-sess.Receive():
-				if max > r.Hops && ip.Equal(r.IP) {
-					max = r.Hops
+		for ttl := t.firstTTL(); ttl <= t.MaxHops && ttl <= max; ttl++ {
+			for flow := 0; flow < t.flows(); flow++ {
+				err = sess.PingFlow(ttl, flow)
+				if err != nil {
+					return err
+				}
+				select {
+				case <-delay.C:
+				case r := <-sess.Receive():
+					if max > r.Hops && ip.Equal(r.IP) {
+						max = r.Hops
+					}
+					h(r)
+				case <-ctx.Done():
+					return ctx.Err()
 				}
-				h(r)
-			case <-ctx.Done():
-				return ctx.Err()
 			}
 		}
 	}
@@ -118,38 +140,25 @@ func (t *Tracer) NewSession(ip net.IP) (*Session, error) {
 	return newSession(t, shortIP(ip)), nil
 }
 
-func (t *Tracer) init() {
-	// 初始化IPv4连接
-	for _, network := range t.Networks {
-		if strings.HasPrefix(network, "ip4") {
-			t.conn, t.err = t.listen(network, t.Addr)
-			if t.err == nil {
-				go t.serve(t.conn)
-				break
-			}
-		}
+// firstTTL 返回首个探测的TTL
+func (c *Config) firstTTL() int {
+	if c.FirstTTL > 0 {
+		return c.FirstTTL
 	}
-	// 初始化IPv6连接
-	for _, network := range t.Networks {
-		if strings.HasPrefix(network, "ip6") {
-			conn, err := net.ListenIP(network, t.Addr)
-			if err == nil {
-				t.ipv6conn = ipv6.NewPacketConn(conn)
-				err = t.ipv6conn.SetControlMessage(ipv6.FlagHopLimit|ipv6.FlagSrc|ipv6.FlagDst|ipv6.FlagInterface, true)
-				if err != nil {
-					if model.EnableLoger {
-						InitLogger()
-						defer Logger.Sync()
-						Logger.Info("设置IPv6控制消息失败: " + err.Error())
-					}
-					t.ipv6conn.Close()
-					continue
-				}
-				go t.serveIPv6(t.ipv6conn)
-				break
-			}
+	return DefaultFirstTTL
+}
+
+func (t *Tracer) init() {
+	t.srcPort = uint16(33434 + rand.Intn(65535-33434-MaxFlows))
+	if t.Transport == nil {
+		var raw *rawTransport
+		raw, t.err = t.listenRaw()
+		if t.err != nil {
+			return
 		}
+		t.Transport = raw
 	}
+	go t.serve(t.Transport)
 }
 
 // Close closes listening socket.
@@ -157,25 +166,31 @@ func (t *Tracer) init() {
 func (t *Tracer) Close() {
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	if t.conn != nil {
-		t.conn.Close()
-	}
-	if t.ipv6conn != nil {
-		t.ipv6conn.Close()
+	if t.Transport != nil {
+		t.Transport.Close()
 	}
 }
-func (t *Tracer) serve(conn *net.IPConn) error {
-	defer conn.Close()
+
+// serve 读取传输层收到的报文并分发给对应的会话
+func (t *Tracer) serve(tr Transport) error {
+	if model.EnableLoger {
+		InitLogger()
+		defer Logger.Sync()
+	}
 	buf := make([]byte, 1500)
 	for {
-		n, from, err := conn.ReadFromIP(buf)
+		n, proto, from, err := tr.ReadFrom(buf)
 		if err != nil {
 			return err
 		}
-		err = t.serveData(from.IP, buf[:n])
-		if err != nil {
+		if proto == ProtocolTCP {
+			_ = t.serveTCPData(from, buf[:n])
 			continue
 		}
+		err = t.serveData(from, buf[:n])
+		if err != nil && from.To4() == nil && model.EnableLoger {
+			Logger.Warn("处理IPv6数据失败: " + err.Error())
+		}
 	}
 }
 
@@ -200,9 +215,13 @@ func (t *Tracer) serveData(from net.IP, b []byte) error {
 				if model.EnableLoger {
 					Logger.Info(fmt.Sprintf("处理IPv6回显应答: ID=%d, Seq=%d", echo.ID, echo.Seq))
 				}
-				return t.serveReply(from, &packet{from, uint16(echo.ID), 1, time.Now()})
+				key, ok := t.echoKey(uint16(echo.ID), uint16(echo.Seq))
+				if !ok {
+					return errUnsupportedProtocol
+				}
+				return t.serveReply(from, &packet{from, key, 1, time.Now()})
 			}
-		case ipv6.ICMPTypeTimeExceeded:
+		case ipv6.ICMPTypeTimeExceeded, ipv6.ICMPTypeDestinationUnreachable:
 			b = getReplyData(msg)
 			if len(b) < ipv6.HeaderLen {
 				if model.EnableLoger {
@@ -220,10 +239,15 @@ func (t *Tracer) serveData(from net.IP, b []byte) error {
 					return err
 				}
 				if model.EnableLoger {
-					Logger.Info(fmt.Sprintf("处理IPv6时间超过: 目标=%v, FlowLabel=%d, HopLimit=%d",
-						ip.Dst, ip.FlowLabel, ip.HopLimit))
+					Logger.Info(fmt.Sprintf("处理IPv6时间超过: 目标=%v, NextHeader=%d, HopLimit=%d",
+						ip.Dst, ip.NextHeader, ip.HopLimit))
+				}
+				// 从引用的ICMPv6 Echo或UDP/TCP头部中取出探测ID，无法识别的报文不属于本Tracer
+				key, ok := t.quotedKey(ip.NextHeader, b[ipv6.HeaderLen:])
+				if !ok {
+					return errUnsupportedProtocol
 				}
-				return t.serveReply(ip.Dst, &packet{from, uint16(ip.FlowLabel), ip.HopLimit, time.Now()})
+				return t.serveReply(ip.Dst, &packet{from, key, ip.HopLimit, time.Now()})
 			}
 		}
 	} else {
@@ -237,7 +261,11 @@ func (t *Tracer) serveData(from net.IP, b []byte) error {
 			if !ok || echo == nil {
 				return errUnsupportedProtocol
 			}
-			return t.serveReply(from, &packet{from, uint16(echo.ID), 1, time.Now()})
+			key, ok := t.echoKey(uint16(echo.ID), uint16(echo.Seq))
+			if !ok {
+				return errUnsupportedProtocol
+			}
+			return t.serveReply(from, &packet{from, key, 1, time.Now()})
 		}
 		b = getReplyData(msg)
 		if len(b) < ipv4.HeaderLen {
@@ -249,6 +277,12 @@ func (t *Tracer) serveData(from net.IP, b []byte) error {
 			if err != nil {
 				return err
 			}
+			// 优先使用引用的ICMP/传输层头部中的探测ID，避免中间设备改写IP ID
+			if ip.Len <= len(b) {
+				if key, ok := t.quotedKey(ip.Protocol, b[ip.Len:]); ok {
+					return t.serveReply(ip.Dst, &packet{from, key, ip.TTL, time.Now()})
+				}
+			}
 			return t.serveReply(ip.Dst, &packet{from, uint16(ip.ID), ip.TTL, time.Now()})
 		default:
 			return errUnsupportedProtocol
@@ -257,38 +291,48 @@ func (t *Tracer) serveData(from net.IP, b []byte) error {
 	return nil
 }
 
-func (t *Tracer) sendRequest(dst net.IP, ttl int) (*packet, error) {
+// sendRequest 发送一个探测包。经典 UDP 探测以会话给出的端口偏移 slot 作为匹配用的ID，
+// 其他协议使用全局递增的ID
+func (t *Tracer) sendRequest(dst net.IP, ttl, flow int, slot uint16) (*packet, error) {
 	id := uint16(atomic.AddUint32(&t.seq, 1))
-	var b []byte
-	req := &packet{dst, id, ttl, time.Now()}
-	if dst.To4() == nil {
-		// IPv6
-		b := newPacketV6(id, dst, ttl)
-		if t.ipv6conn != nil {
-			cm := &ipv6.ControlMessage{
-				HopLimit: ttl,
-			}
-			_, err := t.ipv6conn.WriteTo(b, cm, &net.IPAddr{IP: dst})
-			if err != nil {
-				if model.EnableLoger {
-					InitLogger()
-					defer Logger.Sync()
-					Logger.Info("发送IPv6请求失败: " + err.Error())
-				}
-				return nil, err
-			}
-			return req, nil
+	if id == 0 {
+		// Paris UDP 以校验和携带ID，0 表示未计算校验和
+		id = uint16(atomic.AddUint32(&t.seq, 1))
+	}
+	key := id
+	if t.classicUDP() {
+		key = slot
+	}
+	req := &packet{dst, key, ttl, time.Now()}
+	var (
+		b     []byte
+		proto = ProtocolICMP
+	)
+	if t.protocol() == ProbeICMP {
+		if dst.To4() == nil {
+			b, proto = newPacketV6(t.newEcho(id, flow)), ProtocolIPv6ICMP
+		} else {
+			b = newPacketV4(id, dst, ttl, t.newEcho(id, flow))
 		}
-		return nil, errors.New("IPv6连接不可用")
 	} else {
-		// IPv4
-		b = newPacketV4(id, dst, ttl)
-		_, err := t.conn.WriteToIP(b, &net.IPAddr{IP: dst})
+		src, err := t.sourceAddr(dst)
 		if err != nil {
 			return nil, err
 		}
-		return req, nil
+		b, proto = t.newTransport(src, dst, key, flow)
+		if dst.To4() != nil {
+			b = newProbeV4(proto, id, src, dst, ttl, b)
+		}
+	}
+	if err := t.Transport.WriteTo(b, proto, ttl, dst); err != nil {
+		if model.EnableLoger && dst.To4() == nil {
+			InitLogger()
+			defer Logger.Sync()
+			Logger.Info("发送IPv6请求失败: " + err.Error())
+		}
+		return nil, err
 	}
+	return req, nil
 }
 
 func (t *Tracer) addSession(s *Session) {
@@ -350,6 +394,7 @@ type Session struct {
 
 	mu     sync.RWMutex
 	probes []*packet
+	sent   uint16 // 已发送的探测数，用于计算经典 UDP 探测的端口偏移
 }
 
 // NewSession returns new session.
@@ -369,7 +414,17 @@ func newSession(t *Tracer, ip net.IP) *Session {
 
 // Ping sends single ICMP packet with specified TTL.
 func (s *Session) Ping(ttl int) error {
-	req, err := s.t.sendRequest(s.ip, ttl+1)
+	return s.PingFlow(ttl, 0)
+}
+
+// PingFlow sends single probe of the given flow with specified TTL.
+// Probes of the same flow share their flow identifier when Paris probing is enabled.
+func (s *Session) PingFlow(ttl, flow int) error {
+	s.mu.Lock()
+	slot := s.sent % UDPPortWindow
+	s.sent++
+	s.mu.Unlock()
+	req, err := s.t.sendRequest(s.ip, ttl, flow, slot)
 	if err != nil {
 		return err
 	}
@@ -421,8 +476,7 @@ func (s *Session) handle(res *packet) {
 			// }
 			continue
 		}
-		// 对于IPv6 松散匹配
-		if r.ID == res.ID || res.IP.To4() == nil {
+		if r.ID == res.ID {
 			// if model.EnableLoger {
 			// 	Logger.Info(fmt.Sprintf("找到匹配的探测包: ID=%d, TTL=%d", r.ID, r.TTL))
 			// }
@@ -544,7 +598,19 @@ func (h *Hop) Add(r *Reply) *Node {
 
 // Trace is a simple traceroute tool using DefaultTracer.
 func Trace(ip net.IP) ([]*Hop, error) {
-	hops := make([]*Hop, 0, DefaultTracer.MaxHops)
+	return TraceContext(context.Background(), ip)
+}
+
+// TraceContext is like Trace but stops probing when ctx is done.
+// Hops detected before that are returned together with ctx.Err().
+func TraceContext(ctx context.Context, ip net.IP) ([]*Hop, error) {
+	return DefaultTracer.TraceHops(ctx, ip)
+}
+
+// TraceHops traces ip with t and returns detected hops sorted by distance.
+// Hops detected before ctx is done are returned together with ctx.Err().
+func (t *Tracer) TraceHops(ctx context.Context, ip net.IP) ([]*Hop, error) {
+	hops := make([]*Hop, 0, t.MaxHops)
 	touch := func(dist int) *Hop {
 		for _, h := range hops {
 			if h.Distance == dist {
@@ -555,10 +621,10 @@ func Trace(ip net.IP) ([]*Hop, error) {
 		hops = append(hops, h)
 		return h
 	}
-	err := DefaultTracer.Trace(context.Background(), ip, func(r *Reply) {
+	err := t.Trace(ctx, ip, func(r *Reply) {
 		touch(r.Hops).Add(r)
 	})
-	if err != nil && err != context.DeadlineExceeded {
+	if err != nil && ctx.Err() == nil {
 		return nil, err
 	}
 	sort.Slice(hops, func(i, j int) bool {
@@ -582,5 +648,5 @@ func Trace(ip net.IP) ([]*Hop, error) {
 		hops = hops[:i]
 		break
 	}
-	return hops, nil
+	return hops, ctx.Err()
 }
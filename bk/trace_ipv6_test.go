@@ -0,0 +1,96 @@
+package backtrace
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+)
+
+// quoteIPv6 构造ICMPv6差错报文中引用的原始探测包：IPv6头部加上层报文
+func quoteIPv6(src, dst net.IP, next, hopLimit int, payload []byte) []byte {
+	b := make([]byte, ipv6.HeaderLen+len(payload))
+	b[0] = ipv6.Version << 4
+	binary.BigEndian.PutUint16(b[4:6], uint16(len(payload)))
+	b[6] = byte(next)
+	b[7] = byte(hopLimit)
+	copy(b[8:24], src.To16())
+	copy(b[24:40], dst.To16())
+	copy(b[ipv6.HeaderLen:], payload)
+	return b
+}
+
+// timeExceededV6 构造引用了ID为id的ICMPv6 Echo探测的 Time Exceeded 报文
+func timeExceededV6(t *testing.T, tr *Tracer, dst net.IP, id uint16, flow int) []byte {
+	t.Helper()
+	echo := newPacketV6(tr.newEcho(id, flow))
+	msg := icmp.Message{
+		Type: ipv6.ICMPTypeTimeExceeded,
+		Body: &icmp.TimeExceeded{Data: quoteIPv6(net.ParseIP("2001:db8::1"), dst, ProtocolIPv6ICMP, 1, echo)},
+	}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestServeDataIPv6TimeExceeded(t *testing.T) {
+	dst := net.ParseIP("2001:db8:ffff::7")
+	for _, config := range []Config{{}, {Paris: true}, {Flows: 4}} {
+		tr := &Tracer{Config: config, srcPort: 40000}
+		tr.Timeout = time.Second
+		sess := newSession(tr, shortIP(dst))
+		// 同时有多个待应答的探测时，每个应答只能匹配引用的那个探测
+		sess.probes = append(sess.probes,
+			&packet{dst, 11, 3, time.Now()},
+			&packet{dst, 12, 4, time.Now()},
+			&packet{dst, 13, 5, time.Now()},
+		)
+		if err := tr.serveData(net.ParseIP("2001:db8:1::2"), timeExceededV6(t, tr, dst, 12, tr.flows()-1)); err != nil {
+			t.Fatal(err)
+		}
+		expectReply(t, sess, "2001:db8:1::2", 4)
+		if err := tr.serveData(net.ParseIP("2001:db8:1::1"), timeExceededV6(t, tr, dst, 11, 0)); err != nil {
+			t.Fatal(err)
+		}
+		expectReply(t, sess, "2001:db8:1::1", 3)
+		if len(sess.probes) != 1 || sess.probes[0].ID != 13 {
+			t.Errorf("%+v: pending probes %v, want only ID 13", config, sess.probes)
+		}
+		sess.Close()
+	}
+}
+
+func TestServeDataIPv6Unmatched(t *testing.T) {
+	dst := net.ParseIP("2001:db8:ffff::7")
+	tr, sess := newProbeTestSession(Config{Timeout: time.Second}, dst, 21, 3)
+	// ID不匹配的应答不能占用待应答的探测
+	if err := tr.serveData(net.ParseIP("2001:db8:1::1"), timeExceededV6(t, tr, dst, 22, 0)); err != nil {
+		t.Fatal(err)
+	}
+	// 引用其他程序Echo请求（标识符与序号不一致）的报文被忽略
+	other := newPacketV6(&icmp.Echo{ID: 1234, Seq: 21})
+	msg := icmp.Message{
+		Type: ipv6.ICMPTypeTimeExceeded,
+		Body: &icmp.TimeExceeded{Data: quoteIPv6(net.ParseIP("2001:db8::1"), dst, ProtocolIPv6ICMP, 1, other)},
+	}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.serveData(net.ParseIP("2001:db8:1::1"), b); err == nil {
+		t.Error("foreign echo request accepted")
+	}
+	select {
+	case r := <-sess.Receive():
+		t.Errorf("unexpected reply %+v", r)
+	default:
+	}
+	if len(sess.probes) != 1 {
+		t.Errorf("pending probes %v, want 1", sess.probes)
+	}
+}
@@ -0,0 +1,270 @@
+package backtrace
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// 探测协议
+const (
+	ProbeICMP = "icmp" // ICMP Echo
+	ProbeUDP  = "udp"  // 经典 UDP 高端口探测，目的端口为 Port 加会话内的探测序号
+	ProbeTCP  = "tcp"  // TCP SYN 探测，目的端口固定为 Port
+)
+
+// 各探测协议的默认目的端口
+const (
+	DefaultUDPPort = 33434
+	// UDPPortWindow 是经典 UDP 探测目的端口的取值范围：[Port, Port+UDPPortWindow)
+	UDPPortWindow  = 64
+	DefaultTCPPort = 80
+)
+
+// udpPayload UDP探测携带的数据
+var udpPayload = []byte("HELLO-R-U-THERE")
+
+// protocol 返回配置的探测协议，未配置时为ICMP
+func (c *Config) protocol() string {
+	switch c.Protocol {
+	case ProbeUDP, ProbeTCP:
+		return c.Protocol
+	}
+	return ProbeICMP
+}
+
+// MaxFlows 多路径探测模式下每跳最多使用的流数量
+const MaxFlows = 64
+
+// flows 返回每跳探测的流数量
+func (c *Config) flows() int {
+	switch {
+	case c.Flows > MaxFlows:
+		return MaxFlows
+	case c.Flows > 1:
+		return c.Flows
+	}
+	return 1
+}
+
+// paris 返回是否使用流标识固定的 Paris 探测，多路径探测模式下每条流均使用 Paris 探测
+func (c *Config) paris() bool {
+	return c.Paris || c.flows() > 1
+}
+
+// port 返回UDP/TCP探测使用的目的端口
+func (c *Config) port() uint16 {
+	if c.Port > 0 && c.Port < 65536 {
+		return uint16(c.Port)
+	}
+	if c.protocol() == ProbeTCP {
+		return DefaultTCPPort
+	}
+	return DefaultUDPPort
+}
+
+// classicUDP 判断是否为经典 UDP 探测，此时探测ID为会话内的端口偏移
+func (c *Config) classicUDP() bool {
+	return c.protocol() == ProbeUDP && !c.paris()
+}
+
+// newTransport 构造ID为id、属于第flow条流的UDP或TCP探测报文（不含IP头）。
+// 流标识由源端口区分；TCP 以序列号携带ID，经典 UDP 以目的端口携带会话内的端口偏移，
+// Paris UDP 的端口固定，通过调整载荷使校验和等于ID
+func (t *Tracer) newTransport(src, dst net.IP, id uint16, flow int) (b []byte, proto int) {
+	srcPort := t.srcPort + uint16(flow)
+	switch {
+	case t.protocol() == ProbeTCP:
+		return newTCPSYN(src, dst, srcPort, t.port(), uint32(id)), ProtocolTCP
+	case t.paris():
+		return newParisUDP(src, dst, srcPort, t.port(), id), ProtocolUDP
+	default:
+		return newUDP(src, dst, srcPort, t.port()+id, udpPayload), ProtocolUDP
+	}
+}
+
+// newEcho 构造ICMP Echo报文体。经典模式下ID和序号均为探测ID；
+// Paris 模式下ID为流标识、序号为探测ID，并在载荷开头放入补偿字使同一条流的校验和保持不变
+func (t *Tracer) newEcho(id uint16, flow int) *icmp.Echo {
+	if !t.paris() {
+		return &icmp.Echo{ID: int(id), Seq: int(id), Data: []byte("HELLO-R-U-THERE")}
+	}
+	data := make([]byte, 2, 2+len(udpPayload))
+	binary.BigEndian.PutUint16(data, 0xffff-id)
+	return &icmp.Echo{
+		ID:   int(t.srcPort + uint16(flow)),
+		Seq:  int(id),
+		Data: append(data, udpPayload...),
+	}
+}
+
+// newParisUDP 构造校验和等于id的UDP报文，载荷开头的两个字节用于调整校验和
+func newParisUDP(src, dst net.IP, srcPort, dstPort, id uint16) []byte {
+	payload := make([]byte, 2+len(udpPayload))
+	copy(payload[2:], udpPayload)
+	b := newUDP(src, dst, srcPort, dstPort, payload)
+	// 载荷补偿字为0时的校验和为 ^S，需要 ^(S + w) = id，即 w = ^id + ^S（反码加法）
+	binary.BigEndian.PutUint16(b[6:8], 0)
+	w := onesAdd(^id, transportChecksum(ProtocolUDP, src, dst, b))
+	binary.BigEndian.PutUint16(b[8:10], w)
+	binary.BigEndian.PutUint16(b[6:8], id)
+	return b
+}
+
+// onesAdd 16位反码加法
+func onesAdd(a, b uint16) uint16 {
+	sum := uint32(a) + uint32(b)
+	return uint16(sum&0xffff + sum>>16)
+}
+
+// newUDP 构造带校验和的UDP报文
+func newUDP(src, dst net.IP, srcPort, dstPort uint16, payload []byte) []byte {
+	b := make([]byte, 8+len(payload))
+	binary.BigEndian.PutUint16(b[0:2], srcPort)
+	binary.BigEndian.PutUint16(b[2:4], dstPort)
+	binary.BigEndian.PutUint16(b[4:6], uint16(len(b)))
+	copy(b[8:], payload)
+	csum := transportChecksum(ProtocolUDP, src, dst, b)
+	if csum == 0 {
+		csum = 0xffff
+	}
+	binary.BigEndian.PutUint16(b[6:8], csum)
+	return b
+}
+
+// newTCPSYN 构造带校验和的TCP SYN报文
+func newTCPSYN(src, dst net.IP, srcPort, dstPort uint16, seq uint32) []byte {
+	b := make([]byte, 20)
+	binary.BigEndian.PutUint16(b[0:2], srcPort)
+	binary.BigEndian.PutUint16(b[2:4], dstPort)
+	binary.BigEndian.PutUint32(b[4:8], seq)
+	b[12] = 5 << 4 // 数据偏移，20字节
+	b[13] = tcpFlagSYN
+	binary.BigEndian.PutUint16(b[14:16], 65535)
+	binary.BigEndian.PutUint16(b[16:18], transportChecksum(ProtocolTCP, src, dst, b))
+	return b
+}
+
+// TCP 标志位
+const (
+	tcpFlagSYN = 0x02
+	tcpFlagRST = 0x04
+	tcpFlagACK = 0x10
+)
+
+// transportChecksum 计算带伪首部的TCP/UDP校验和
+func transportChecksum(proto int, src, dst net.IP, b []byte) uint16 {
+	var sum uint32
+	add := func(p []byte) {
+		for i := 0; i+1 < len(p); i += 2 {
+			sum += uint32(p[i])<<8 | uint32(p[i+1])
+		}
+		if len(p)%2 == 1 {
+			sum += uint32(p[len(p)-1]) << 8
+		}
+	}
+	if s4, d4 := src.To4(), dst.To4(); s4 != nil && d4 != nil {
+		add(s4)
+		add(d4)
+		sum += uint32(proto) + uint32(len(b))
+	} else {
+		add(src.To16())
+		add(dst.To16())
+		sum += uint32(len(b)>>16) + uint32(len(b)&0xffff) + uint32(proto)
+	}
+	add(b)
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// sourceAddr 返回发往dst时使用的本地地址，用于计算校验和
+func (t *Tracer) sourceAddr(dst net.IP) (net.IP, error) {
+	if t.Addr != nil && t.Addr.IP != nil && (t.Addr.IP.To4() != nil) == (dst.To4() != nil) {
+		return t.Addr.IP, nil
+	}
+	t.mu.RLock()
+	src, ok := t.srcAddrs[string(dst)]
+	t.mu.RUnlock()
+	if ok {
+		return src, nil
+	}
+	// UDP Dial 不会发送报文，仅用于查询路由选择的源地址
+	conn, err := net.Dial("udp", net.JoinHostPort(dst.String(), "53"))
+	if err != nil {
+		return nil, fmt.Errorf("查询源地址失败: %w", err)
+	}
+	defer conn.Close()
+	src = conn.LocalAddr().(*net.UDPAddr).IP
+	if v := src.To4(); v != nil {
+		src = v
+	}
+	t.mu.Lock()
+	if t.srcAddrs == nil {
+		t.srcAddrs = make(map[string]net.IP)
+	}
+	t.srcAddrs[string(dst)] = src
+	t.mu.Unlock()
+	return src, nil
+}
+
+// ownPort 判断端口是否为本Tracer某条流使用的源端口
+func (t *Tracer) ownPort(port uint16) bool {
+	return port >= t.srcPort && int(port-t.srcPort) < t.flows()
+}
+
+// quotedKey 从ICMP差错报文引用的UDP/TCP/ICMP头部中取出探测ID
+func (t *Tracer) quotedKey(proto int, b []byte) (uint16, bool) {
+	switch proto {
+	case ProtocolUDP:
+		if len(b) < 8 || !t.ownPort(binary.BigEndian.Uint16(b[0:2])) {
+			return 0, false
+		}
+		if t.paris() {
+			return binary.BigEndian.Uint16(b[6:8]), true
+		}
+		off := binary.BigEndian.Uint16(b[2:4]) - t.port()
+		return off, off < UDPPortWindow
+	case ProtocolTCP:
+		if len(b) < 8 || !t.ownPort(binary.BigEndian.Uint16(b[0:2])) {
+			return 0, false
+		}
+		return uint16(binary.BigEndian.Uint32(b[4:8])), true
+	case ProtocolICMP, ProtocolIPv6ICMP:
+		// 引用的报文须为ICMP Echo请求：类型(1) 代码(1) 校验和(2) 标识符(2) 序号(2)
+		if len(b) < 8 || (b[0] != byte(ipv4.ICMPTypeEcho) && b[0] != byte(ipv6.ICMPTypeEchoRequest)) {
+			return 0, false
+		}
+		return t.echoKey(binary.BigEndian.Uint16(b[4:6]), binary.BigEndian.Uint16(b[6:8]))
+	}
+	return 0, false
+}
+
+// echoKey 根据ICMP Echo的标识符和序号取出探测ID，并确认报文由本Tracer发出
+func (t *Tracer) echoKey(id, seq uint16) (uint16, bool) {
+	if t.paris() {
+		return seq, t.ownPort(id)
+	}
+	return seq, id == seq
+}
+
+// serveTCPData 处理目标直接返回的 SYN-ACK 或 RST 报文
+func (t *Tracer) serveTCPData(from net.IP, b []byte) error {
+	if len(b) < 20 {
+		return errMessageTooShort
+	}
+	srcPort := binary.BigEndian.Uint16(b[0:2])
+	dstPort := binary.BigEndian.Uint16(b[2:4])
+	flags := b[13]
+	if srcPort != t.port() || !t.ownPort(dstPort) || flags&(tcpFlagRST|tcpFlagACK) == 0 {
+		return errUnsupportedProtocol
+	}
+	ack := binary.BigEndian.Uint32(b[8:12])
+	return t.serveReply(from, &packet{from, uint16(ack - 1), 1, time.Now()})
+}
@@ -0,0 +1,177 @@
+package backtrace
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+func TestTransportChecksum(t *testing.T) {
+	// 校验和正确时，对包含校验和的整个报文再次计算结果为0
+	src, dst := net.ParseIP("192.0.2.1"), net.ParseIP("198.51.100.7")
+	if c := transportChecksum(ProtocolUDP, src, dst, newUDP(src, dst, 40000, 33441, udpPayload)); c != 0 {
+		t.Errorf("UDP checksum does not verify: %#04x", c)
+	}
+	if c := transportChecksum(ProtocolTCP, src, dst, newTCPSYN(src, dst, 40000, 443, 12)); c != 0 {
+		t.Errorf("TCP checksum does not verify: %#04x", c)
+	}
+	src6, dst6 := net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")
+	if c := transportChecksum(ProtocolUDP, src6, dst6, newUDP(src6, dst6, 40000, 33441, udpPayload)); c != 0 {
+		t.Errorf("UDPv6 checksum does not verify: %#04x", c)
+	}
+}
+
+// newProbeTestSession 创建不打开套接字的Tracer及其会话，并登记一个待应答的探测
+func newProbeTestSession(config Config, dst net.IP, id uint16, ttl int) (*Tracer, *Session) {
+	tr := &Tracer{Config: config, srcPort: 40000}
+	sess := newSession(tr, shortIP(dst))
+	sess.probes = append(sess.probes, &packet{dst, id, ttl, time.Now()})
+	return tr, sess
+}
+
+func expectReply(t *testing.T, sess *Session, ip string, hops int) {
+	t.Helper()
+	select {
+	case r := <-sess.Receive():
+		if !r.IP.Equal(net.ParseIP(ip)) || r.Hops != hops {
+			t.Errorf("got reply from %v at hop %d, want %s at hop %d", r.IP, r.Hops, ip, hops)
+		}
+	default:
+		t.Errorf("no reply from %s", ip)
+	}
+}
+
+func TestServeDataQuotedUDP(t *testing.T) {
+	src, dst := net.ParseIP("192.0.2.1").To4(), net.ParseIP("198.51.100.7").To4()
+	tr, sess := newProbeTestSession(Config{Protocol: ProbeUDP, Timeout: time.Second}, dst, 7, 5)
+	payload, proto := tr.newTransport(src, dst, 7, 0)
+	// 中间设备改写了IP ID，仍应根据UDP目的端口匹配
+	quoted := newProbeV4(proto, 999, src, dst, 1, payload)
+	msg := icmp.Message{Type: ipv4.ICMPTypeTimeExceeded, Body: &icmp.TimeExceeded{Data: quoted}}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.serveData(net.ParseIP("203.0.113.1"), b); err != nil {
+		t.Fatal(err)
+	}
+	expectReply(t, sess, "203.0.113.1", 5)
+}
+
+// recordTransport 记录发出的探测包，不产生应答
+type recordTransport struct{ sent [][]byte }
+
+func (r *recordTransport) WriteTo(b []byte, proto, hopLimit int, dst net.IP) error {
+	r.sent = append(r.sent, b)
+	return nil
+}
+
+func (r *recordTransport) ReadFrom(b []byte) (int, int, net.IP, error) { select {} }
+
+func (r *recordTransport) Close() error { return nil }
+
+func TestUDPPortWindow(t *testing.T) {
+	src, dst := net.ParseIP("192.0.2.1").To4(), net.ParseIP("198.51.100.7").To4()
+	rec := &recordTransport{}
+	tr := &Tracer{
+		Config:    Config{Protocol: ProbeUDP, Timeout: time.Second},
+		Transport: rec,
+		srcPort:   40000,
+		srcAddrs:  map[string]net.IP{string(dst): src},
+	}
+	// 全局ID已接近回绕时，目的端口仍应落在会话内的窗口中
+	tr.seq = 0xfff0
+	sess := newSession(tr, dst)
+	for i := 0; i < 2*UDPPortWindow; i++ {
+		if err := sess.PingFlow(2+i%16, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, b := range rec.sent {
+		port := binary.BigEndian.Uint16(b[ipv4.HeaderLen+2 : ipv4.HeaderLen+4])
+		if want := DefaultUDPPort + uint16(i%UDPPortWindow); port != want {
+			t.Fatalf("probe %d: destination port %d, want %d", i, port, want)
+		}
+	}
+	// 应答通过会话中的端口偏移对应到最近一次使用该端口的探测
+	sess.probes = sess.probes[len(sess.probes)-1:]
+	quoted := rec.sent[len(rec.sent)-1]
+	quoted[8] = 1 // 报文到期时引用的TTL为1
+	msg := icmp.Message{Type: ipv4.ICMPTypeTimeExceeded, Body: &icmp.TimeExceeded{Data: quoted}}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.serveData(net.ParseIP("203.0.113.1"), b); err != nil {
+		t.Fatal(err)
+	}
+	expectReply(t, sess, "203.0.113.1", 17)
+	// 窗口之外的端口不属于本Tracer
+	binary.BigEndian.PutUint16(quoted[ipv4.HeaderLen+2:], DefaultUDPPort+UDPPortWindow)
+	if _, ok := tr.quotedKey(ProtocolUDP, quoted[ipv4.HeaderLen:]); ok {
+		t.Error("port outside the window accepted")
+	}
+}
+
+func TestServeTCPData(t *testing.T) {
+	dst := net.ParseIP("198.51.100.7").To4()
+	tr, sess := newProbeTestSession(Config{Protocol: ProbeTCP, Port: 443, Timeout: time.Second}, dst, 9, 12)
+	synAck := make([]byte, 20)
+	binary.BigEndian.PutUint16(synAck[0:2], 443)
+	binary.BigEndian.PutUint16(synAck[2:4], tr.srcPort)
+	binary.BigEndian.PutUint32(synAck[8:12], 9+1)
+	synAck[13] = tcpFlagSYN | tcpFlagACK
+	if err := tr.serveTCPData(dst, synAck); err != nil {
+		t.Fatal(err)
+	}
+	expectReply(t, sess, "198.51.100.7", 12)
+	// 其他端口的报文不应被匹配
+	binary.BigEndian.PutUint16(synAck[0:2], 80)
+	if err := tr.serveTCPData(dst, synAck); err == nil {
+		t.Error("unrelated TCP segment accepted")
+	}
+}
+
+func TestParisFlowIdentifier(t *testing.T) {
+	src, dst := net.ParseIP("192.0.2.1").To4(), net.ParseIP("198.51.100.7").To4()
+	tr := &Tracer{Config: Config{Protocol: ProbeUDP, Flows: 4}, srcPort: 40000}
+	// 多路径模式使用 Paris 探测：UDP 的端口在探测间保持不变，校验和携带探测ID且仍然有效
+	for _, id := range []uint16{1, 2, 0x7fff, 0xfffe, 0xffff} {
+		b, _ := tr.newTransport(src, dst, id, 3)
+		if port := binary.BigEndian.Uint16(b[0:2]); port != 40003 {
+			t.Errorf("id %d: source port %d, want 40003", id, port)
+		}
+		if port := binary.BigEndian.Uint16(b[2:4]); port != DefaultUDPPort {
+			t.Errorf("id %d: destination port %d, want %d", id, port, DefaultUDPPort)
+		}
+		if c := binary.BigEndian.Uint16(b[6:8]); c != id {
+			t.Errorf("id %d: checksum %#04x", id, c)
+		}
+		if c := transportChecksum(ProtocolUDP, src, dst, b); c != 0 {
+			t.Errorf("id %d: checksum does not verify: %#04x", id, c)
+		}
+		if key, ok := tr.quotedKey(ProtocolUDP, b); !ok || key != id {
+			t.Errorf("id %d: quoted key %d, %v", id, key, ok)
+		}
+	}
+	// Paris ICMP 的标识符和校验和在同一条流内保持不变
+	var sum []byte
+	for _, id := range []uint16{1, 2, 500} {
+		b := newPacketV4(id, dst, 5, tr.newEcho(id, 1))
+		msg, err := icmp.ParseMessage(ProtocolICMP, b[ipv4.HeaderLen:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if echo := msg.Body.(*icmp.Echo); echo.ID != 40001 || echo.Seq != int(id) {
+			t.Errorf("id %d: echo ID=%d Seq=%d", id, echo.ID, echo.Seq)
+		}
+		if sum != nil && string(b[ipv4.HeaderLen+2:ipv4.HeaderLen+4]) != string(sum) {
+			t.Errorf("id %d: ICMP checksum changed", id)
+		}
+		sum = b[ipv4.HeaderLen+2 : ipv4.HeaderLen+4]
+	}
+}
@@ -0,0 +1,226 @@
+package backtrace
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oneclickvirt/backtrace/model"
+	"github.com/oneclickvirt/backtrace/rules"
+	"github.com/oneclickvirt/backtrace/simnet"
+)
+
+// newSimTracer 返回使用模拟网络的Tracer
+func newSimTracer(network *simnet.Network, config Config) *Tracer {
+	config.Delay = 20 * time.Millisecond
+	config.Timeout = 200 * time.Millisecond
+	config.MaxHops = 10
+	config.Count = 1
+	config.Addr = &net.IPAddr{IP: net.ParseIP("192.0.2.1").To4()}
+	return &Tracer{Config: config, Transport: network}
+}
+
+func hopIPs(hops []*Hop) string {
+	var parts []string
+	for _, h := range hops {
+		var ips []string
+		for _, n := range h.Nodes {
+			ips = append(ips, n.IP.String())
+		}
+		parts = append(parts, strings.Join(ips, "|"))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestTraceSimulated(t *testing.T) {
+	dst := net.ParseIP("198.51.100.7")
+	for _, proto := range []string{ProbeICMP, ProbeUDP, ProbeTCP} {
+		network := simnet.New(1)
+		network.AddRoute(dst,
+			simnet.Hop{IP: net.ParseIP("10.0.0.1"), Latency: time.Millisecond},
+			simnet.Hop{IP: net.ParseIP("59.43.1.1"), Latency: 3 * time.Millisecond},
+			simnet.Hop{},
+			simnet.Hop{IP: net.ParseIP("202.97.1.1"), Latency: 5 * time.Millisecond, Loss: 1},
+			simnet.Hop{IP: dst, Latency: 6 * time.Millisecond},
+		)
+		tracer := newSimTracer(network, Config{Protocol: proto})
+		hops, err := tracer.TraceHops(context.Background(), dst)
+		tracer.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", proto, err)
+		}
+		// 默认从TTL 2开始，第1跳不会被探测；第3跳不响应、第4跳全部丢包，目标在第5跳
+		if got, want := hopIPs(hops), "59.43.1.1 198.51.100.7"; got != want {
+			t.Errorf("%s: hops %q, want %q", proto, got, want)
+		}
+		if len(hops) == 2 && (hops[0].Distance != 2 || hops[1].Distance != 5 || hops[0].Nodes[0].RTT[0] < 3*time.Millisecond) {
+			t.Errorf("%s: distances %d/%d, hop 2 RTT %v", proto, hops[0].Distance, hops[1].Distance, hops[0].Nodes[0].RTT)
+		}
+	}
+}
+
+func TestTraceSimulatedFirstTTL(t *testing.T) {
+	dst := net.ParseIP("198.51.100.7")
+	for firstTTL, want := range map[int]string{
+		1: "10.0.0.1 59.43.1.1 198.51.100.7",
+		3: "198.51.100.7",
+	} {
+		network := simnet.New(1)
+		network.AddRoute(dst,
+			simnet.Hop{IP: net.ParseIP("10.0.0.1"), Latency: time.Millisecond},
+			simnet.Hop{IP: net.ParseIP("59.43.1.1"), Latency: time.Millisecond},
+			simnet.Hop{},
+			simnet.Hop{IP: dst, Latency: time.Millisecond},
+		)
+		tracer := newSimTracer(network, Config{FirstTTL: firstTTL})
+		hops, err := tracer.TraceHops(context.Background(), dst)
+		tracer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hopIPs(hops); got != want {
+			t.Errorf("first TTL %d: hops %q, want %q", firstTTL, got, want)
+		}
+	}
+}
+
+func TestTraceSimulatedDefaultRange(t *testing.T) {
+	dst := net.ParseIP("198.51.100.16")
+	route := make([]simnet.Hop, 16)
+	for i := range route[:15] {
+		route[i] = simnet.Hop{IP: net.IPv4(10, 0, 0, byte(i+1)), Latency: time.Millisecond}
+	}
+	route[15] = simnet.Hop{IP: dst, Latency: time.Millisecond}
+	network := simnet.New(1)
+	network.AddRoute(dst, route...)
+	// 除缩短等待时间外使用默认配置，第16跳的目标仍在探测范围内
+	config := DefaultConfig
+	config.Delay = 5 * time.Millisecond
+	config.Timeout = 200 * time.Millisecond
+	config.Addr = &net.IPAddr{IP: net.ParseIP("192.0.2.1").To4()}
+	tracer := &Tracer{Config: config, Transport: network}
+	defer tracer.Close()
+	hops, err := tracer.TraceHops(context.Background(), dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hops) != 15 || hops[0].Distance != 2 || hops[14].Distance != 16 || !hops[14].Nodes[0].IP.Equal(dst) {
+		t.Errorf("hops %q", hopIPs(hops))
+	}
+}
+
+func TestTraceSimulatedIPv6(t *testing.T) {
+	dst := net.ParseIP("2001:db8:ffff::7")
+	network := simnet.New(1)
+	network.AddRoute(dst,
+		simnet.Hop{IP: net.ParseIP("2001:db8:1::1"), Latency: time.Millisecond},
+		simnet.Hop{IP: net.ParseIP("2001:db8:2::1"), Latency: time.Millisecond},
+		simnet.Hop{IP: dst, Latency: time.Millisecond},
+	)
+	defer network.Close()
+	hops, err := newSimTracer(network, Config{}).TraceHops(context.Background(), dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hopIPs(hops), "2001:db8:2::1 2001:db8:ffff::7"; got != want {
+		t.Errorf("hops %q, want %q", got, want)
+	}
+}
+
+func TestTraceSimulatedECMP(t *testing.T) {
+	dst := net.ParseIP("198.51.100.9")
+	trace := func(config Config) []*Hop {
+		network := simnet.New(1)
+		for _, middle := range []string{"59.43.1.1", "59.43.2.2"} {
+			network.AddRoute(dst,
+				simnet.Hop{IP: net.ParseIP("10.0.0.1"), Latency: time.Millisecond},
+				simnet.Hop{IP: net.ParseIP(middle), Latency: time.Millisecond},
+				simnet.Hop{IP: net.ParseIP(strings.Replace(middle, "59.43", "202.97", 1)), Latency: time.Millisecond},
+				simnet.Hop{IP: dst, Latency: time.Millisecond},
+			)
+		}
+		tracer := newSimTracer(network, config)
+		defer tracer.Close()
+		hops, err := tracer.TraceHops(context.Background(), dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hops
+	}
+	// Paris 探测的所有包走同一条路径，不会拼出不存在的路由
+	got := hopIPs(trace(Config{Protocol: ProbeUDP, Paris: true}))
+	if got != "59.43.1.1 202.97.1.1 198.51.100.9" && got != "59.43.2.2 202.97.2.2 198.51.100.9" {
+		t.Errorf("paris hops %q mix ECMP branches", got)
+	}
+	// 多路径探测列出两条分支上的全部节点
+	hops := trace(Config{Protocol: ProbeUDP, Flows: 8})
+	if len(hops) != 3 || len(hops[0].Nodes) != 2 || len(hops[1].Nodes) != 2 {
+		t.Errorf("multipath hops %q, want both branches at hops 2 and 3", hopIPs(hops))
+	}
+}
+
+func TestTraceTargetSimulated(t *testing.T) {
+	dst := net.ParseIP("198.51.100.8")
+	network := simnet.New(1)
+	network.AddRoute(dst,
+		simnet.Hop{IP: net.ParseIP("10.0.0.1"), Latency: time.Millisecond},
+		simnet.Hop{IP: net.ParseIP("202.97.1.1"), Latency: time.Millisecond},
+		simnet.Hop{IP: net.ParseIP("59.43.1.1"), Latency: time.Millisecond},
+		simnet.Hop{IP: dst, Latency: time.Millisecond},
+	)
+	defer network.Close()
+	opts := Options{Tracer: newSimTracer(network, Config{})}
+	result := traceTarget(context.Background(), model.Target{Name: "sim", IP: dst.String(), IPVersion: "ipv4"}, opts, nil)
+	var lines []string
+	for _, line := range result.Lines {
+		lines = append(lines, line.Name)
+	}
+	if result.Reason != "" || strings.Join(lines, ",") != "CN2GT,163" {
+		t.Errorf("lines %v, reason %q, want CN2GT,163", lines, result.Reason)
+	}
+	if result.TracedIP != dst.String() {
+		t.Errorf("traced IP %q, want %s", result.TracedIP, dst)
+	}
+	if len(result.Hops) != 3 || result.Hops[2].Nodes[0].IP != dst.String() {
+		t.Errorf("unexpected hops %+v", result.Hops)
+	}
+}
+
+func TestTraceTargetPanic(t *testing.T) {
+	dst := net.ParseIP("198.51.100.8")
+	network := simnet.New(1)
+	network.AddRoute(dst, simnet.Hop{IP: net.ParseIP("10.0.0.1")}, simnet.Hop{IP: net.ParseIP("202.97.1.1")}, simnet.Hop{IP: dst})
+	defer network.Close()
+	// 损坏的规则集在识别线路时panic，应报告为内部错误而不是超时
+	opts := Options{Tracer: newSimTracer(network, Config{}), Rules: &rules.RuleSet{Rules: []*rules.Rule{nil}}}
+	result := traceTarget(context.Background(), model.Target{Name: "sim", IP: dst.String(), IPVersion: "v4"}, opts, nil)
+	if result == nil || result.Reason != ReasonInternal || result.Error == "" || result.TimedOut {
+		t.Errorf("result after panic = %+v", result)
+	}
+}
+
+func TestMergeHops(t *testing.T) {
+	hop := func(dist int, ip string) *Hop {
+		return &Hop{Distance: dist, Nodes: []*Node{{IP: net.ParseIP(ip), RTT: []time.Duration{time.Millisecond}}}}
+	}
+	attempts := [][]*Hop{
+		{hop(1, "10.0.0.1"), hop(2, "59.43.1.1"), hop(3, "198.51.100.7")},
+		{hop(1, "10.0.0.1"), hop(2, "202.97.1.1"), hop(3, "198.51.100.7")},
+		{hop(1, "10.0.0.1"), hop(2, "59.43.1.1")},
+	}
+	// 按多数原则选择每个位置的节点
+	if got, want := hopIPs(mergeHops(attempts)), "10.0.0.1 59.43.1.1 198.51.100.7"; got != want {
+		t.Errorf("mergeHops = %q, want %q", got, want)
+	}
+	if got, want := hopIPs(unionHops(attempts)), "10.0.0.1 59.43.1.1|202.97.1.1 198.51.100.7"; got != want {
+		t.Errorf("unionHops = %q, want %q", got, want)
+	}
+	// 第3跳只在3次追踪中的2次有响应
+	hops := newHopResults(mergeHops(attempts))
+	annotateLoss(hops, attempts, 1)
+	if hops[0].Loss != 0 || hops[2].Loss < 0.33 || hops[2].Loss > 0.34 {
+		t.Errorf("loss = %v, %v", hops[0].Loss, hops[2].Loss)
+	}
+}
@@ -0,0 +1,208 @@
+package backtrace
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/oneclickvirt/backtrace/model"
+	. "github.com/oneclickvirt/defaultset"
+	"golang.org/x/net/ipv6"
+)
+
+// Transport Tracer 发送探测包及接收应答的传输层，
+// 默认使用原始套接字，测试中可替换为模拟网络
+type Transport interface {
+	// WriteTo 向 dst 发送探测包：IPv4 时 b 为含IP头的完整报文，
+	// IPv6 时 b 为 proto 协议的上层报文，以 hopLimit 作为跳数限制发送
+	WriteTo(b []byte, proto, hopLimit int, dst net.IP) error
+	// ReadFrom 读取下一条不含IP头的报文（ICMP/ICMPv6 报文或目标返回的TCP报文），
+	// 返回报文长度、协议及源地址
+	ReadFrom(b []byte) (n, proto int, src net.IP, err error)
+	// Close 关闭传输层，阻塞中的 ReadFrom 随即返回
+	Close() error
+}
+
+// rawMessage 原始套接字收到的一条报文
+type rawMessage struct {
+	b     []byte
+	proto int
+	src   net.IP
+}
+
+// rawTransport 基于原始套接字的 Transport 实现
+type rawTransport struct {
+	conn      *net.IPConn      // IPv4连接
+	ipv6conn  *ipv6.PacketConn // IPv6连接
+	tcpConn   *net.IPConn      // IPv4 TCP应答连接
+	ipv6probe *ipv6.PacketConn // IPv6 UDP/TCP探测连接
+
+	in        chan rawMessage
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// listenRaw 按配置打开原始套接字，IPv4 ICMP 套接字无法打开时返回错误
+func (t *Tracer) listenRaw() (*rawTransport, error) {
+	r := &rawTransport{
+		in:   make(chan rawMessage, 64),
+		done: make(chan struct{}),
+	}
+	var err error
+	// 初始化IPv4连接
+	for _, network := range t.Networks {
+		if strings.HasPrefix(network, "ip4") {
+			r.conn, err = t.listen(network, t.Addr)
+			if err == nil {
+				go r.readIPv4(r.conn, ProtocolICMP)
+				break
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 初始化IPv6连接
+	for _, network := range t.Networks {
+		if strings.HasPrefix(network, "ip6") {
+			conn, err := net.ListenIP(network, t.Addr)
+			if err == nil {
+				r.ipv6conn = ipv6.NewPacketConn(conn)
+				err = r.ipv6conn.SetControlMessage(ipv6.FlagHopLimit|ipv6.FlagSrc|ipv6.FlagDst|ipv6.FlagInterface, true)
+				if err != nil {
+					if model.EnableLoger {
+						InitLogger()
+						defer Logger.Sync()
+						Logger.Info("设置IPv6控制消息失败: " + err.Error())
+					}
+					r.ipv6conn.Close()
+					r.ipv6conn = nil
+					continue
+				}
+				go r.readIPv6(r.ipv6conn, ProtocolIPv6ICMP)
+				break
+			}
+		}
+	}
+	r.listenProbeConns(t)
+	return r, nil
+}
+
+// listenProbeConns 为UDP/TCP探测打开额外的原始套接字：
+// IPv4 的探测报文通过带 IP_HDRINCL 的ICMP套接字发送，只需监听TCP应答；
+// IPv6 的探测报文需要通过对应协议的套接字发送
+func (r *rawTransport) listenProbeConns(t *Tracer) {
+	proto := t.protocol()
+	if proto == ProbeICMP {
+		return
+	}
+	if proto == ProbeTCP {
+		if conn, err := net.ListenIP("ip4:tcp", t.Addr); err == nil {
+			r.tcpConn = conn
+			go r.readIPv4(conn, ProtocolTCP)
+		} else if model.EnableLoger {
+			Logger.Info("监听IPv4 TCP失败: " + err.Error())
+		}
+	}
+	if conn, err := net.ListenIP("ip6:"+proto, t.Addr); err == nil {
+		r.ipv6probe = ipv6.NewPacketConn(conn)
+		if proto == ProbeTCP {
+			go r.readIPv6(r.ipv6probe, ProtocolTCP)
+		}
+	} else if model.EnableLoger {
+		Logger.Info("监听IPv6 " + proto + "失败: " + err.Error())
+	}
+}
+
+// readIPv4 读取IPv4原始套接字上的报文
+func (r *rawTransport) readIPv4(conn *net.IPConn, proto int) {
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFromIP(buf)
+		if err != nil {
+			return
+		}
+		if !r.deliver(rawMessage{append([]byte(nil), buf[:n]...), proto, from.IP}) {
+			return
+		}
+	}
+}
+
+// readIPv6 读取IPv6原始套接字上的报文
+func (r *rawTransport) readIPv6(conn *ipv6.PacketConn, proto int) {
+	buf := make([]byte, 1500)
+	for {
+		n, _, src, err := conn.ReadFrom(buf)
+		if err != nil {
+			if model.EnableLoger {
+				Logger.Error("读取IPv6响应失败: " + err.Error())
+			}
+			return
+		}
+		addr, ok := src.(*net.IPAddr)
+		if !ok || addr == nil || addr.IP == nil {
+			continue
+		}
+		if !r.deliver(rawMessage{append([]byte(nil), buf[:n]...), proto, addr.IP}) {
+			return
+		}
+	}
+}
+
+// deliver 投递报文，传输已关闭时返回false
+func (r *rawTransport) deliver(msg rawMessage) bool {
+	select {
+	case r.in <- msg:
+		return true
+	case <-r.done:
+		return false
+	}
+}
+
+func (r *rawTransport) WriteTo(b []byte, proto, hopLimit int, dst net.IP) error {
+	if dst.To4() != nil {
+		if r.conn == nil {
+			return errors.New("IPv4连接不可用")
+		}
+		_, err := r.conn.WriteToIP(b, &net.IPAddr{IP: dst})
+		return err
+	}
+	conn := r.ipv6conn
+	if proto != ProtocolIPv6ICMP {
+		conn = r.ipv6probe
+	}
+	if conn == nil {
+		return errors.New("IPv6连接不可用")
+	}
+	_, err := conn.WriteTo(b, &ipv6.ControlMessage{HopLimit: hopLimit}, &net.IPAddr{IP: dst})
+	return err
+}
+
+func (r *rawTransport) ReadFrom(b []byte) (int, int, net.IP, error) {
+	select {
+	case msg := <-r.in:
+		return copy(b, msg.b), msg.proto, msg.src, nil
+	case <-r.done:
+		return 0, 0, nil, net.ErrClosed
+	}
+}
+
+func (r *rawTransport) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.done)
+		if r.conn != nil {
+			r.conn.Close()
+		}
+		if r.ipv6conn != nil {
+			r.ipv6conn.Close()
+		}
+		if r.tcpConn != nil {
+			r.tcpConn.Close()
+		}
+		if r.ipv6probe != nil {
+			r.ipv6probe.Close()
+		}
+	})
+	return nil
+}
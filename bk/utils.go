@@ -1,20 +1,17 @@
 package backtrace
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
+	"sort"
 	"strings"
-	"time"
 
-	"github.com/imroc/req/v3"
 	"github.com/oneclickvirt/backtrace/model"
 	. "github.com/oneclickvirt/defaultset"
 )
 
 type Result struct {
 	i int
-	s string
+	r *TargetResult
 }
 
 // removeDuplicates 切片去重
@@ -33,159 +30,38 @@ func removeDuplicates(elements []string) []string {
 	return result
 }
 
-// checkCdn 检查CDN可用性，参考shell脚本的测试逻辑
-func checkCdn(testUrl string) string {
-	client := req.C()
-	client.SetTimeout(6 * time.Second)
-	if model.EnableLoger {
-		InitLogger()
-		defer Logger.Sync()
-	}
-	for _, cdnUrl := range model.CdnList {
-		url := cdnUrl + testUrl
-		if model.EnableLoger {
-			Logger.Info(fmt.Sprintf("Testing CDN: %s", url))
-		}
-		resp, err := client.R().Get(url)
-		if err == nil && resp != nil && resp.Body != nil {
-			b, err := io.ReadAll(resp.Body)
-			resp.Body.Close()
-			if err == nil && strings.Contains(string(b), "success") {
-				if model.EnableLoger {
-					Logger.Info(fmt.Sprintf("CDN available: %s", cdnUrl))
-				}
-				return cdnUrl
-			}
-		}
-		if model.EnableLoger {
-			Logger.Info(fmt.Sprintf("CDN test failed: %s, error: %v", cdnUrl, err))
-		}
-		time.Sleep(500 * time.Millisecond)
-	}
-	if model.EnableLoger {
-		Logger.Info("No CDN available, using direct connection")
-	}
-	return ""
-}
-
-// getData 获取目标地址的文本内容
-func getData(endpoint string) string {
-	client := req.C()
-	client.SetTimeout(6 * time.Second)
-	client.R().
-		SetRetryCount(2).
-		SetRetryBackoffInterval(1*time.Second, 5*time.Second).
-		SetRetryFixedInterval(2 * time.Second)
-	if model.EnableLoger {
-		InitLogger()
-		defer Logger.Sync()
-	}
-	
-	// 先测试CDN可用性
-	testUrl := "https://raw.githubusercontent.com/spiritLHLS/ecs/main/back/test"
-	cdnUrl := checkCdn(testUrl)
-	
-	// 如果有可用的CDN，使用CDN获取数据
-	if cdnUrl != "" {
-		url := cdnUrl + endpoint
-		if model.EnableLoger {
-			Logger.Info(fmt.Sprintf("Using CDN: %s", url))
-		}
-		resp, err := client.R().Get(url)
-		if err == nil && resp != nil && resp.Body != nil {
-			defer resp.Body.Close()
-			b, err := io.ReadAll(resp.Body)
-			if err == nil && !strings.Contains(string(b), "error") {
-				if model.EnableLoger {
-					Logger.Info(fmt.Sprintf("Received data length: %d", len(b)))
-				}
-				return string(b)
-			}
-		}
-		if model.EnableLoger {
-			Logger.Info(fmt.Sprintf("CDN request failed: %v", err))
-		}
-	}
-	
-	// CDN不可用，尝试直连
-	if model.EnableLoger {
-		Logger.Info(fmt.Sprintf("Trying direct connection: %s", endpoint))
-	}
-	resp, err := client.R().Get(endpoint)
-	if err == nil && resp != nil && resp.Body != nil {
-		defer resp.Body.Close()
-		b, err := io.ReadAll(resp.Body)
-		if err == nil {
-			if model.EnableLoger {
-				Logger.Info(fmt.Sprintf("Received data length: %d", len(b)))
-			}
-			return string(b)
-		}
-	}
-	if model.EnableLoger {
-		Logger.Info(fmt.Sprintf("Direct connection failed: %v", err))
-	}
-	return ""
-}
-
-// parseIcmpTargets 解析ICMP目标数据
-func parseIcmpTargets(jsonData string) []model.IcmpTarget {
-	var targets []model.IcmpTarget
-	err := json.Unmarshal([]byte(jsonData), &targets)
-	if err != nil {
+// tryAlternativeIPs 获取目标的备选IP地址，优先使用目标自带的备选地址，其次从ICMP目标数据中按省份和运营商匹配，
+// icmpTargets 只在需要匹配时调用
+func tryAlternativeIPs(target model.Target, icmpTargets func() []model.IcmpTarget) []string {
+	if len(target.FallbackIPs) > 0 {
 		if model.EnableLoger {
-			Logger.Info(fmt.Sprintf("解析ICMP目标失败: %s", err.Error()))
+			Logger.Info(fmt.Sprintf("使用目标自带的备选地址: %s %v", target.Name, target.FallbackIPs))
 		}
-		return nil
+		return target.FallbackIPs
 	}
-	return targets
-}
-
-// tryAlternativeIPs 从IcmpTargets获取备选IP地址
-func tryAlternativeIPs(targetName string, ipVersion string) []string {
-	if model.ParsedIcmpTargets == nil || (model.ParsedIcmpTargets != nil && len(model.ParsedIcmpTargets) == 0) {
+	// 没有省份和ISP信息时无法匹配
+	if icmpTargets == nil || target.Province == "" || target.ISP == "" {
 		return nil
 	}
 	if model.EnableLoger {
-		Logger.Info(fmt.Sprintf("使用备选地址: %s %s", targetName, ipVersion))
-	}
-	// 从目标名称中提取省份和ISP信息
-	var targetProvince, targetISP string
-	if strings.Contains(targetName, "北京") {
-		targetProvince = "北京"
-	} else if strings.Contains(targetName, "上海") {
-		targetProvince = "上海"
-	} else if strings.Contains(targetName, "广州") {
-		targetProvince = "广东"
-	} else if strings.Contains(targetName, "成都") {
-		targetProvince = "四川"
-	}
-	if strings.Contains(targetName, "电信") {
-		targetISP = "电信"
-	} else if strings.Contains(targetName, "联通") {
-		targetISP = "联通"
-	} else if strings.Contains(targetName, "移动") {
-		targetISP = "移动"
-	}
-	// 如果没有提取到信息，返回空
-	if targetProvince == "" || targetISP == "" {
-		return nil
+		Logger.Info(fmt.Sprintf("使用备选地址: %s %s", target.Name, target.IPVersion))
 	}
 	// 查找匹配条件的目标
 	var result []string
-	for _, target := range model.ParsedIcmpTargets {
+	for _, it := range icmpTargets() {
 		// 检查省份是否匹配（可能带有"省"字或不带）
-		provinceMatch := (target.Province == targetProvince) || (target.Province == targetProvince+"省")
+		provinceMatch := (it.Province == target.Province) || (it.Province == target.Province+"省")
 		// 检查ISP和IP版本是否匹配
-		if provinceMatch && target.ISP == targetISP && target.IPVersion == ipVersion {
+		if provinceMatch && it.ISP == target.ISP && it.IPVersion == target.IPVersion {
 			// 解析IP列表
-			if target.IPs != "" {
-				ips := strings.Split(target.IPs, ",")
+			if it.IPs != "" {
+				ips := strings.Split(it.IPs, ",")
 				// 最多返回3个IP地址
 				count := 0
 				for _, ip := range ips {
-					if ip != "" {
-						result = append(result, strings.TrimSpace(ip))
+					// 跳过与主地址相同的地址
+					if ip = strings.TrimSpace(ip); ip != "" && ip != target.IP {
+						result = append(result, ip)
 						count++
 						if count >= 3 {
 							break
@@ -273,3 +149,28 @@ func mergeHops(allHops [][]*Hop) []*Hop {
 	}
 	return mergedHops
 }
+
+// unionHops 按距离合并多次追踪的全部节点，用于多路径探测模式
+func unionHops(allHops [][]*Hop) []*Hop {
+	var merged []*Hop
+	byDistance := make(map[int]*Hop)
+	for _, hops := range allHops {
+		for _, hop := range hops {
+			h, ok := byDistance[hop.Distance]
+			if !ok {
+				h = &Hop{Distance: hop.Distance}
+				byDistance[hop.Distance] = h
+				merged = append(merged, h)
+			}
+			for _, node := range hop.Nodes {
+				for _, rtt := range node.RTT {
+					h.Add(&Reply{IP: node.IP, RTT: rtt, Hops: hop.Distance})
+				}
+			}
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].Distance < merged[j].Distance
+	})
+	return merged
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	backtrace "github.com/oneclickvirt/backtrace/bk"
+	"github.com/oneclickvirt/backtrace/store"
+	. "github.com/oneclickvirt/defaultset"
+)
+
+// diffMain backtrace diff 子命令：比较结果文件中的两次检测，存在显著变化时以状态码1退出，出错时以状态码2退出
+func diffMain(args []string) {
+	var storeFile, outputFormat string
+	var oldID, newID int
+	var opts backtrace.DiffOptions
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.StringVar(&storeFile, "store", "", "Result store written by -store")
+	fs.IntVar(&oldID, "old", -2, "ID of the old run, negative values count from the latest run")
+	fs.IntVar(&newID, "new", -1, "ID of the new run, negative values count from the latest run")
+	fs.DurationVar(&opts.LatencyThreshold, "latency", backtrace.DefaultLatencyThreshold, "Minimum RTT increase to the target reported as a latency regression")
+	fs.Float64Var(&opts.LatencyRatio, "latency-ratio", backtrace.DefaultLatencyRatio, "Minimum relative RTT increase reported as a latency regression")
+	fs.StringVar(&outputFormat, "format", formatText, "Output format: text or json")
+	fs.Parse(args)
+	if storeFile == "" || (outputFormat != formatText && outputFormat != formatJSON) {
+		fs.Usage()
+		os.Exit(2)
+	}
+	runs, err := store.Load(storeFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	oldRun, err := store.Find(runs, oldID)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	newRun, err := store.Find(runs, newID)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	os.Exit(printDiff(oldRun, newRun, opts, outputFormat))
+}
+
+// printDiff 输出两次检测的差异并返回退出状态码
+func printDiff(oldRun, newRun *store.Run, opts backtrace.DiffOptions, outputFormat string) int {
+	diffs := backtrace.DiffResults(oldRun.Results, newRun.Results, opts)
+	significant := false
+	for _, d := range diffs {
+		if d.Significant() {
+			significant = true
+		}
+	}
+	if outputFormat == formatJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(struct {
+			Old         int                     `json:"old"`
+			New         int                     `json:"new"`
+			Significant bool                    `json:"significant"`
+			Targets     []*backtrace.TargetDiff `json:"targets"`
+		}{oldRun.ID, newRun.ID, significant, diffs}); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	} else {
+		fmt.Printf("#%d %s -> #%d %s\n", oldRun.ID, oldRun.Time.Format("2006-01-02 15:04:05"),
+			newRun.ID, newRun.Time.Format("2006-01-02 15:04:05"))
+		if text := backtrace.FormatDiffs(diffs); text != "" {
+			fmt.Println(text)
+		} else {
+			fmt.Println(Green("两次检测结果一致"))
+		}
+	}
+	if significant {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	backtrace "github.com/oneclickvirt/backtrace/bk"
+	"github.com/oneclickvirt/backtrace/metrics"
+	"github.com/oneclickvirt/backtrace/model"
+)
+
+// exporterMain backtrace exporter 子命令：周期性执行检测并以Prometheus文本格式导出指标
+func exporterMain(args []string) {
+	var listen, targetsFile string
+	var interval, timeout time.Duration
+	var ipv6 bool
+	var probe probeOptions
+	fs := flag.NewFlagSet("exporter", flag.ExitOnError)
+	fs.StringVar(&listen, "listen", ":9150", "Listen address of the metrics endpoint")
+	fs.DurationVar(&interval, "interval", 5*time.Minute, "Interval between two runs")
+	fs.DurationVar(&timeout, "timeout", backtrace.DefaultTimeout, "Timeout of a single run")
+	fs.BoolVar(&ipv6, "ipv6", false, "Enable ipv6 testing")
+	fs.StringVar(&targetsFile, "targets", "", "Load trace targets from a JSON or YAML file")
+	fs.BoolVar(&model.EnableLoger, "log", false, "Enable logging")
+	probe.register(fs)
+	fs.Parse(args)
+	if interval <= 0 || timeout <= 0 {
+		fmt.Fprintln(os.Stderr, "interval and timeout must be positive")
+		os.Exit(2)
+	}
+	config, err := probe.tracerConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	var targets []model.Target
+	if targetsFile != "" {
+		targets, err = backtrace.LoadTargets(targetsFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	lineRules, db, geo := probe.mustLoad()
+	collector := metrics.New()
+	opts := backtrace.Options{
+		EnableIPv6:    ipv6,
+		Timeout:       timeout,
+		Targets:       targets,
+		ASNDB:         db,
+		Tracer:        &backtrace.Tracer{Config: config},
+		Trace:         backtrace.TraceOptions{Attempts: probe.attempts},
+		Rules:         lineRules,
+		TargetsSource: probe.targetsSource,
+		ReverseDNS:    probe.reverseDNS(),
+		GeoIP:         geo,
+	}
+	go monitor(context.Background(), collector, opts, interval)
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", collector)
+	fmt.Fprintf(os.Stderr, "backtrace exporter listening on %s\n", listen)
+	if err := http.ListenAndServe(listen, mux); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// monitor 立即执行一次检测，之后每隔 interval 执行一次，直到 ctx 结束
+func monitor(ctx context.Context, collector *metrics.Collector, opts backtrace.Options, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		start := time.Now()
+		results := backtrace.BackTraceContext(ctx, opts)
+		collector.Observe(results, time.Since(start))
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
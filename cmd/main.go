@@ -1,34 +1,29 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/oneclickvirt/backtrace/bgptools"
 	backtrace "github.com/oneclickvirt/backtrace/bk"
 	"github.com/oneclickvirt/backtrace/model"
+	"github.com/oneclickvirt/backtrace/store"
 	"github.com/oneclickvirt/backtrace/utils"
+	"github.com/oneclickvirt/backtrace/vantage"
 	. "github.com/oneclickvirt/defaultset"
 )
 
-type IpInfo struct {
-	Ip      string `json:"ip"`
-	City    string `json:"city"`
-	Region  string `json:"region"`
-	Country string `json:"country"`
-	Org     string `json:"org"`
-}
-
 type ConcurrentResults struct {
-	bgpResult       string
-	backtraceResult string
-	bgpError        error
+	bgpResult        *bgptools.PoPResult
+	backtraceResults []*backtrace.TargetResult
+	bgpError         error
 	// backtraceError  error
 }
 
@@ -43,6 +38,34 @@ func safeGo(wg *sync.WaitGroup, fn func()) {
 	}()
 }
 
+// selectTargets 逐个选择本次检测的目标：-targets 中的IPv6目标仅在启用IPv6检测时保留，
+// -target 解析出的IPv6目标只要本机有IPv6网络即保留。返回保留的目标及因本机没有IPv6网络而跳过的 -target 目标
+func selectTargets(fileTargets, explicit []model.Target, useIPv6, hostIPv6 bool) (selected, skipped []model.Target) {
+	for _, t := range fileTargets {
+		if t.IPVersion != "v6" || useIPv6 {
+			selected = append(selected, t)
+		}
+	}
+	for _, t := range explicit {
+		if t.IPVersion == "v6" && !hostIPv6 {
+			skipped = append(skipped, t)
+			continue
+		}
+		selected = append(selected, t)
+	}
+	return selected, skipped
+}
+
+// hasIPv6 判断目标中是否有IPv6目标
+func hasIPv6(targets []model.Target) bool {
+	for _, t := range targets {
+		if t.IPVersion == "v6" {
+			return true
+		}
+	}
+	return false
+}
+
 func main() {
 	go func() {
 		resp, err := http.Get("https://hits.spiritlhl.net/backtrace.svg?action=hit&title=Hits&title_bg=%23555555&count_bg=%230eecf8&edge_flat=false")
@@ -50,19 +73,49 @@ func main() {
 			resp.Body.Close()
 		}
 	}()
-	fmt.Println(Green("Repo:"), Yellow("https://github.com/oneclickvirt/backtrace"))
-	var showVersion, showIpInfo, help, ipv6 bool
-	var specifiedIP string
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "serve":
+			serveMain(os.Args[2:])
+			return
+		case "exporter":
+			exporterMain(os.Args[2:])
+			return
+		case "diff":
+			diffMain(os.Args[2:])
+			return
+		}
+	}
+	var showVersion, showIpInfo, help, ipv6, detail bool
+	var specifiedIP, outputFormat, targetsFile, targetHosts, resolveFamily, storeFile, upstreamName, asRelFile string
+	var probe probeOptions
 	backtraceFlag := flag.NewFlagSet("backtrace", flag.ContinueOnError)
 	backtraceFlag.BoolVar(&help, "h", false, "Show help information")
 	backtraceFlag.BoolVar(&showVersion, "v", false, "Show version")
 	backtraceFlag.BoolVar(&showIpInfo, "s", true, "Disabe show ip info")
 	backtraceFlag.BoolVar(&model.EnableLoger, "log", false, "Enable logging")
 	backtraceFlag.BoolVar(&ipv6, "ipv6", false, "Enable ipv6 testing")
-	backtraceFlag.StringVar(&specifiedIP, "ip", "", "Specify IP address for bgptools")
+	backtraceFlag.BoolVar(&detail, "detail", false, "Show every hop with RTT, ASN and line label")
+	backtraceFlag.StringVar(&specifiedIP, "ip", "", "Specify IP address for the upstream lookup")
+	backtraceFlag.StringVar(&upstreamName, "upstream", bgptools.ProviderBGPTools, "Upstream provider: bgptools, ripestat or caida")
+	backtraceFlag.StringVar(&asRelFile, "as-rel", "", "CAIDA AS relationship file (serial-1 or serial-2) for -upstream caida")
+	backtraceFlag.StringVar(&outputFormat, "format", formatText, "Output format: text, json or ndjson")
+	backtraceFlag.StringVar(&targetsFile, "targets", "", "Load trace targets from a JSON or YAML file")
+	backtraceFlag.StringVar(&targetHosts, "target", "", "Trace comma-separated hostnames or IP addresses instead of the built-in targets")
+	backtraceFlag.StringVar(&resolveFamily, "resolve", backtrace.ResolveAuto, "Address family for -target hostnames: auto, 4, 6 or all")
+	backtraceFlag.StringVar(&storeFile, "store", "", "Append the results of this run to a JSON Lines result store for backtrace diff")
+	probe.register(backtraceFlag)
 	backtraceFlag.Parse(os.Args[1:])
+	if !validFormat(outputFormat) {
+		fmt.Fprintf(os.Stderr, "unsupported output format: %s\n", outputFormat)
+		os.Exit(2)
+	}
+	textMode := outputFormat == formatText
+	if textMode {
+		fmt.Println(Green("Repo:"), Yellow("https://github.com/oneclickvirt/backtrace"))
+	}
 	if help {
-		fmt.Printf("Usage: %s [options]\n", os.Args[0])
+		fmt.Printf("Usage: %s [options]\n       %s serve [options]\n       %s exporter [options]\n       %s diff -store file [options]\n", os.Args[0], os.Args[0], os.Args[0], os.Args[0])
 		backtraceFlag.PrintDefaults()
 		return
 	}
@@ -70,17 +123,45 @@ func main() {
 		fmt.Println(model.BackTraceVersion)
 		return
 	}
-	info := IpInfo{}
+	config, err := probe.tracerConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	var targets, explicitTargets []model.Target
+	if targetsFile != "" {
+		var err error
+		targets, err = backtrace.LoadTargets(targetsFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	if targetHosts != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		resolved, err := backtrace.ResolveTargets(ctx, strings.Split(targetHosts, ","), resolveFamily, nil)
+		cancel()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		explicitTargets = resolved
+	}
+	lineRules, db, geo := probe.mustLoad()
+	upstreams, err := newUpstreamProvider(upstreamName, asRelFile, db)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	report := newReport()
+	var info *vantage.Info
 	if showIpInfo {
-		rsp, err := http.Get("http://ipinfo.io")
+		info, err = detectVantage(geo, specifiedIP)
 		if err != nil {
-			fmt.Printf("get ip info err %v \n", err.Error())
+			fmt.Fprintf(os.Stderr, "获取本机IP信息失败: %v\n", err)
 		} else {
-			defer rsp.Body.Close()
-			err = json.NewDecoder(rsp.Body).Decode(&info)
-			if err != nil {
-				fmt.Printf("json decode err %v \n", err.Error())
-			} else {
+			report.IPInfo = info
+			if textMode {
 				fmt.Println(Green("国家: ") + White(info.Country) + Green(" 城市: ") + White(info.City) +
 					Green(" 服务商: ") + Blue(info.Org))
 			}
@@ -88,45 +169,50 @@ func main() {
 	}
 	preCheck := utils.CheckPublicAccess(3 * time.Second)
 	if !preCheck.Connected {
-		fmt.Println(Red("PreCheck IP Type Failed"))
-		if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
-			fmt.Println("Press Enter to exit...")
-			fmt.Scanln()
-		}
+		precheckFailed(textMode)
 		return
 	}
-	var useIPv6 bool
+	var useIPv6, hostIPv6 bool
 	switch preCheck.StackType {
 	case "DualStack":
-		useIPv6 = ipv6
+		useIPv6, hostIPv6 = ipv6, true
 	case "IPv4":
-		useIPv6 = false
+		useIPv6, hostIPv6 = false, false
 	case "IPv6":
-		useIPv6 = true
+		useIPv6, hostIPv6 = true, true
 	default:
-		fmt.Println(Red("PreCheck IP Type Failed"))
-		if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
-			fmt.Println("Press Enter to exit...")
-			fmt.Scanln()
-		}
+		precheckFailed(textMode)
 		return
 	}
+	if targetHosts != "" {
+		// 指定的目标按解析结果检测，其中的IPv6目标无需 -ipv6；其余目标已按 -ipv6 选择，
+		// 因此只有保留了IPv6目标时才开启IPv6检测
+		selected, skipped := selectTargets(targets, explicitTargets, useIPv6, hostIPv6)
+		for _, t := range skipped {
+			fmt.Fprintf(os.Stderr, "本机没有IPv6网络，跳过目标 %s (%s)\n", t.Name, t.IP)
+		}
+		if len(selected) == 0 {
+			fmt.Fprintln(os.Stderr, "no target can be traced on this host, use -resolve 4 for hostnames with A records")
+			os.Exit(1)
+		}
+		targets, useIPv6 = selected, hasIPv6(selected)
+	}
 	results := ConcurrentResults{}
 	var wg sync.WaitGroup
 	var targetIP string
 	if specifiedIP != "" {
 		targetIP = specifiedIP
-	} else if info.Ip != "" {
-		targetIP = info.Ip
+	} else if info != nil {
+		targetIP = info.IP
 	}
 	if targetIP != "" {
 		wg.Add(1)
 		safeGo(&wg, func() {
 			for i := 0; i < 2; i++ {
-				result, err := bgptools.GetPoPInfo(targetIP)
+				result, err := upstreams.Upstreams(context.Background(), targetIP)
 				results.bgpError = err
 				if err == nil && result.Result != "" {
-					results.bgpResult = result.Result
+					results.bgpResult = result
 					return
 				}
 				if i == 0 {
@@ -137,18 +223,67 @@ func main() {
 	}
 	wg.Add(1)
 	safeGo(&wg, func() {
-		result := backtrace.BackTrace(useIPv6)
-		results.backtraceResult = result
+		results.backtraceResults = backtrace.BackTraceContext(context.Background(), backtrace.Options{
+			EnableIPv6:    useIPv6,
+			Targets:       targets,
+			ASNDB:         db,
+			Tracer:        &backtrace.Tracer{Config: config},
+			Trace:         backtrace.TraceOptions{Attempts: probe.attempts},
+			Rules:         lineRules,
+			TargetsSource: probe.targetsSource,
+			ReverseDNS:    probe.reverseDNS(),
+			GeoIP:         geo,
+		})
 	})
 	wg.Wait()
-	if results.bgpResult != "" {
-		fmt.Print(results.bgpResult)
+	if storeFile != "" {
+		err := store.Append(storeFile, &store.Run{
+			Time:    time.Now(),
+			Version: model.BackTraceVersion,
+			Results: results.backtraceResults,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "save results: %v\n", err)
+		}
+	}
+	if !textMode {
+		report.Upstreams = results.bgpResult
+		report.Results = append(report.Results, results.backtraceResults...)
+		if err := writeReport(os.Stdout, outputFormat, report); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
 	}
-	if results.backtraceResult != "" {
-		fmt.Printf("%s\n", results.backtraceResult)
+	if results.bgpResult != nil {
+		fmt.Print(results.bgpResult.Result)
+	}
+	if len(results.backtraceResults) > 0 {
+		if detail {
+			fmt.Printf("%s\n", backtrace.FormatDetails(results.backtraceResults))
+		} else {
+			fmt.Printf("%s\n", backtrace.FormatResults(results.backtraceResults))
+		}
 	}
 	fmt.Println(Yellow("准确线路自行查看详细路由，本测试结果仅作参考"))
-	fmt.Println(Yellow("同一目标地址多个线路时，检测可能已越过汇聚层，除第一个线路外，后续信息可能无效"))
+	for _, r := range results.backtraceResults {
+		if r != nil && r.MultipleLines() {
+			fmt.Println(Yellow("同一目标地址多个线路时，检测可能已越过汇聚层，除第一个线路外，后续信息可能无效"))
+			break
+		}
+	}
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		fmt.Println("Press Enter to exit...")
+		fmt.Scanln()
+	}
+}
+
+func precheckFailed(textMode bool) {
+	if !textMode {
+		fmt.Fprintln(os.Stderr, "PreCheck IP Type Failed")
+		os.Exit(1)
+	}
+	fmt.Println(Red("PreCheck IP Type Failed"))
 	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
 		fmt.Println("Press Enter to exit...")
 		fmt.Scanln()
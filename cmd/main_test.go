@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/oneclickvirt/backtrace/model"
+)
+
+func TestSelectTargets(t *testing.T) {
+	file := []model.Target{
+		{Name: "file-v4", IP: "198.51.100.1", IPVersion: "v4"},
+		{Name: "file-v6", IP: "2001:db8::2", IPVersion: "v6"},
+	}
+	explicit := []model.Target{
+		{Name: "example.com", IP: "192.0.2.1", IPVersion: "v4"},
+		{Name: "example.net", IP: "2001:db8::1", IPVersion: "v6"},
+	}
+	names := func(targets []model.Target) (s []string) {
+		for _, t := range targets {
+			s = append(s, t.Name)
+		}
+		return s
+	}
+	tests := []struct {
+		useIPv6, hostIPv6 bool
+		selected, skipped []string
+	}{
+		// 双栈且未指定 -ipv6：只有 -target 的IPv6目标被检测
+		{false, true, []string{"file-v4", "example.com", "example.net"}, nil},
+		{true, true, []string{"file-v4", "file-v6", "example.com", "example.net"}, nil},
+		{false, false, []string{"file-v4", "example.com"}, []string{"example.net"}},
+	}
+	for _, tt := range tests {
+		selected, skipped := selectTargets(file, explicit, tt.useIPv6, tt.hostIPv6)
+		if got := names(selected); !reflect.DeepEqual(got, tt.selected) {
+			t.Errorf("useIPv6=%v hostIPv6=%v: selected %v, want %v", tt.useIPv6, tt.hostIPv6, got, tt.selected)
+		}
+		if got := names(skipped); !reflect.DeepEqual(got, tt.skipped) {
+			t.Errorf("useIPv6=%v hostIPv6=%v: skipped %v, want %v", tt.useIPv6, tt.hostIPv6, got, tt.skipped)
+		}
+	}
+	if !hasIPv6(explicit) || hasIPv6(explicit[:1]) {
+		t.Error("hasIPv6")
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/oneclickvirt/backtrace/bgptools"
+	backtrace "github.com/oneclickvirt/backtrace/bk"
+	"github.com/oneclickvirt/backtrace/model"
+	"github.com/oneclickvirt/backtrace/vantage"
+)
+
+// 输出格式
+const (
+	formatText   = "text"
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+)
+
+// Report 一次完整检测的机器可读文档
+type Report struct {
+	Version   string                    `json:"version"`
+	IPInfo    *vantage.Info             `json:"ip_info,omitempty"`
+	Upstreams *bgptools.PoPResult       `json:"upstreams,omitempty"`
+	Results   []*backtrace.TargetResult `json:"results"`
+}
+
+// record NDJSON 中的单行记录，Type 取值为 ip_info、upstreams 或 target
+type record struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+func validFormat(format string) bool {
+	switch format {
+	case formatText, formatJSON, formatNDJSON:
+		return true
+	}
+	return false
+}
+
+// writeReport 按指定格式输出检测结果
+func writeReport(w io.Writer, format string, report *Report) error {
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case formatNDJSON:
+		enc := json.NewEncoder(w)
+		if report.IPInfo != nil {
+			if err := enc.Encode(record{"ip_info", report.IPInfo}); err != nil {
+				return err
+			}
+		}
+		if report.Upstreams != nil {
+			if err := enc.Encode(record{"upstreams", report.Upstreams}); err != nil {
+				return err
+			}
+		}
+		for _, r := range report.Results {
+			if err := enc.Encode(record{"target", r}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported output format: %s", format)
+}
+
+func newReport() *Report {
+	return &Report{
+		Version: model.BackTraceVersion,
+		Results: []*backtrace.TargetResult{},
+	}
+}
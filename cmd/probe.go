@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/oneclickvirt/backtrace/asndb"
+	backtrace "github.com/oneclickvirt/backtrace/bk"
+	"github.com/oneclickvirt/backtrace/geoip"
+	"github.com/oneclickvirt/backtrace/icmpdata"
+	"github.com/oneclickvirt/backtrace/rdns"
+	"github.com/oneclickvirt/backtrace/rules"
+)
+
+// probeOptions 探测及线路识别相关的命令行参数，主命令和 serve 子命令共用
+type probeOptions struct {
+	protocol      string
+	port          int
+	paris         bool
+	flows         int
+	rulesFile     string
+	asnDBFile     string
+	asnNamesFile  string
+	targetsSource string // 用于匹配备选地址的ICMP目标数据来源
+	rdns          bool
+	rdnsServer    string
+	rdnsWorkers   int
+	geoIPFiles    string
+	geoIPLang     string
+	maxHops       int
+	probeTimeout  time.Duration
+	probeDelay    time.Duration
+	probes        int
+	attempts      int
+	firstTTL      int
+	source        string
+}
+
+func (o *probeOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.protocol, "protocol", backtrace.ProbeICMP, "Probe protocol: icmp, udp or tcp")
+	fs.IntVar(&o.port, "port", 0, "Destination port for tcp probes, base port for udp probes (default 80 for tcp, 33434 for udp)")
+	fs.IntVar(&o.maxHops, "max-hops", backtrace.DefaultConfig.MaxHops, "TTL of the last probe, i.e. the farthest hop probed")
+	fs.DurationVar(&o.probeTimeout, "probe-timeout", backtrace.DefaultConfig.Timeout, "Time to wait for replies after the last probe of a trace")
+	fs.DurationVar(&o.probeDelay, "probe-delay", backtrace.DefaultConfig.Delay, "Delay between two probes")
+	fs.IntVar(&o.probes, "probes", backtrace.DefaultConfig.Count, "Number of probes per hop")
+	fs.IntVar(&o.attempts, "attempts", backtrace.DefaultAttempts, "Number of concurrent traces per target, merged into one result")
+	fs.IntVar(&o.firstTTL, "first-ttl", backtrace.DefaultFirstTTL, "TTL of the first probe, 1 to include the local gateway")
+	fs.StringVar(&o.source, "source", "", "Source address of probes, IPv6 probing requires an IPv6 address")
+	fs.BoolVar(&o.paris, "paris", false, "Keep probe flow identifiers constant (Paris traceroute) to avoid ECMP artifacts")
+	fs.IntVar(&o.flows, "flows", 1, "Probe every hop with this many Paris flows to discover all ECMP branches")
+	fs.StringVar(&o.rulesFile, "rules", "", "Load line classification rules from a YAML or JSON file")
+	fs.StringVar(&o.asnDBFile, "asn-db", "", "Annotate hops with origin ASN from a local ip2asn TSV or MRT RIB dump")
+	fs.StringVar(&o.asnNamesFile, "asn-names", "", "Load AS names for -asn-db from a file of \"ASN name\" lines")
+	fs.StringVar(&o.geoIPFiles, "geoip", "", "Annotate hops and the local IP with locations from comma-separated MaxMind .mmdb files (City/ASN)")
+	fs.StringVar(&o.geoIPLang, "geoip-lang", "en", "Language of the names from -geoip, e.g. zh-CN")
+	fs.BoolVar(&o.rdns, "rdns", false, "Resolve hop hostnames (PTR) and decode router locations from them")
+	fs.StringVar(&o.rdnsServer, "rdns-server", "", "DNS server (host or host:port) for -rdns, system resolver if empty")
+	fs.IntVar(&o.rdnsWorkers, "rdns-workers", rdns.DefaultConcurrency, "Maximum number of concurrent PTR queries for -rdns")
+	fs.StringVar(&o.targetsSource, "targets-source", "", "Local file or mirror URL of the ICMP target data used to find fallback addresses (default "+icmpdata.DefaultSource+")")
+}
+
+// traceOptions 校验并返回追踪参数
+func (o *probeOptions) traceOptions() (backtrace.TraceOptions, error) {
+	trace := backtrace.TraceOptions{
+		MaxHops:  o.maxHops,
+		Timeout:  o.probeTimeout,
+		Delay:    o.probeDelay,
+		Count:    o.probes,
+		Attempts: o.attempts,
+		FirstTTL: o.firstTTL,
+	}
+	switch {
+	case o.maxHops < 1 || o.maxHops > 255:
+		return trace, fmt.Errorf("-max-hops must be between 1 and 255")
+	case o.firstTTL < 1 || o.firstTTL > o.maxHops:
+		return trace, fmt.Errorf("-first-ttl must be between 1 and -max-hops (%d)", o.maxHops)
+	case o.probeTimeout <= 0 || o.probeDelay <= 0:
+		return trace, fmt.Errorf("-probe-timeout and -probe-delay must be positive")
+	case o.probes < 1 || o.attempts < 1:
+		return trace, fmt.Errorf("-probes and -attempts must be at least 1")
+	}
+	if o.source != "" {
+		trace.Source = net.ParseIP(o.source)
+		if trace.Source == nil {
+			return trace, fmt.Errorf("invalid source address: %s", o.source)
+		}
+	}
+	return trace, nil
+}
+
+// tracerConfig 校验探测协议及追踪参数并返回对应的Tracer配置
+func (o *probeOptions) tracerConfig() (backtrace.Config, error) {
+	switch o.protocol {
+	case backtrace.ProbeICMP, backtrace.ProbeUDP, backtrace.ProbeTCP:
+	default:
+		return backtrace.Config{}, fmt.Errorf("unsupported probe protocol: %s", o.protocol)
+	}
+	// -port 为0时使用协议的默认端口
+	if o.port < 0 || o.port > 65535 {
+		return backtrace.Config{}, fmt.Errorf("-port must be between 1 and 65535")
+	}
+	if o.flows < 1 || o.flows > backtrace.MaxFlows {
+		return backtrace.Config{}, fmt.Errorf("-flows must be between 1 and %d", backtrace.MaxFlows)
+	}
+	trace, err := o.traceOptions()
+	if err != nil {
+		return backtrace.Config{}, err
+	}
+	config := trace.Apply(backtrace.DefaultConfig)
+	config.Protocol = o.protocol
+	config.Port = o.port
+	config.Paris = o.paris
+	config.Flows = o.flows
+	return config, nil
+}
+
+// reverseDNS 返回 -rdns 对应的反向解析器，未启用时返回nil
+func (o *probeOptions) reverseDNS() *rdns.Resolver {
+	if !o.rdns {
+		return nil
+	}
+	return &rdns.Resolver{Addr: o.rdnsServer, Concurrency: o.rdnsWorkers}
+}
+
+// loadRules 加载 -rules 指定的规则文件，未指定时返回nil以使用内置规则
+func (o *probeOptions) loadRules() (*rules.RuleSet, error) {
+	if o.rulesFile == "" {
+		return nil, nil
+	}
+	return rules.Load(o.rulesFile)
+}
+
+// mustLoad 加载规则、ASN数据库及地理位置数据库并校验ICMP目标数据文件，失败时退出
+func (o *probeOptions) mustLoad() (*rules.RuleSet, *asndb.DB, *geoip.DB) {
+	lineRules, err := o.loadRules()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	db, err := loadASNDB(o.asnDBFile, o.asnNamesFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	var geo *geoip.DB
+	if o.geoIPFiles != "" {
+		geo, err = geoip.Open(strings.Split(o.geoIPFiles, ",")...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "load geoip database: %v\n", err)
+			os.Exit(2)
+		}
+		geo.Language = o.geoIPLang
+	}
+	// 本地数据文件在检测前校验，网络地址不可用时会回退到缓存或内置快照
+	if o.targetsSource != "" && !strings.HasPrefix(o.targetsSource, "http://") && !strings.HasPrefix(o.targetsSource, "https://") {
+		loader := icmpdata.Loader{Source: o.targetsSource}
+		if _, err := loader.Load(context.Background()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	return lineRules, db, geo
+}
+
+// loadASNDB 加载离线ASN数据库及可选的AS名称文件，未指定数据库时返回nil
+func loadASNDB(dbFile, namesFile string) (*asndb.DB, error) {
+	if dbFile == "" {
+		return nil, nil
+	}
+	db, err := asndb.Open(dbFile)
+	if err != nil {
+		return nil, fmt.Errorf("load ASN database: %w", err)
+	}
+	if namesFile != "" {
+		f, err := os.Open(namesFile)
+		if err != nil {
+			return nil, fmt.Errorf("load AS names: %w", err)
+		}
+		defer f.Close()
+		if err := db.LoadNames(f); err != nil {
+			return nil, fmt.Errorf("load AS names: %w", err)
+		}
+	}
+	return db, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTracerConfig(t *testing.T) {
+	cases := []struct {
+		args []string
+		err  string // 期望的错误信息片段，为空时应成功
+	}{
+		{nil, ""},
+		{[]string{"-protocol", "tcp", "-port", "443", "-flows", "64", "-max-hops", "30", "-first-ttl", "1", "-source", "192.0.2.1"}, ""},
+		{[]string{"-protocol", "sctp"}, "unsupported probe protocol"},
+		{[]string{"-port", "-1"}, "-port"},
+		{[]string{"-port", "65536"}, "-port"},
+		{[]string{"-flows", "0"}, "-flows"},
+		{[]string{"-flows", "65"}, "-flows"},
+		{[]string{"-max-hops", "0"}, "-max-hops"},
+		{[]string{"-max-hops", "10", "-first-ttl", "11"}, "-first-ttl"},
+		{[]string{"-probe-timeout", "0s"}, "-probe-timeout"},
+		{[]string{"-probes", "0"}, "-probes"},
+		{[]string{"-attempts", "0"}, "-attempts"},
+		{[]string{"-source", "example.com"}, "invalid source address"},
+	}
+	for _, c := range cases {
+		var probe probeOptions
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		probe.register(fs)
+		if err := fs.Parse(c.args); err != nil {
+			t.Fatalf("%v: %v", c.args, err)
+		}
+		config, err := probe.tracerConfig()
+		switch {
+		case c.err == "" && err != nil:
+			t.Errorf("%v: %v", c.args, err)
+		case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+			t.Errorf("%v: error %v, want %q", c.args, err, c.err)
+		case c.err == "" && len(c.args) > 0 && (config.Port != 443 || config.Flows != 64 || config.MaxHops != 30 || config.FirstTTL != 1 || config.Addr == nil):
+			t.Errorf("%v: config %+v", c.args, config)
+		case c.err == "" && len(c.args) == 0 && config.Timeout != 500*time.Millisecond:
+			t.Errorf("default config %+v", config)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oneclickvirt/backtrace/asndb"
+	backtrace "github.com/oneclickvirt/backtrace/bk"
+	"github.com/oneclickvirt/backtrace/geoip"
+	"github.com/oneclickvirt/backtrace/model"
+	"github.com/oneclickvirt/backtrace/rdns"
+	"github.com/oneclickvirt/backtrace/rules"
+)
+
+// 检测任务状态
+const (
+	statusRunning = "running"
+	statusDone    = "done"
+)
+
+// maxTestTimeout 单次检测允许的最长超时时间
+const maxTestTimeout = 5 * time.Minute
+
+// testRequest 启动检测的请求体
+type testRequest struct {
+	IPv6    bool            `json:"ipv6"`              // 是否检测IPv6目标
+	Timeout int             `json:"timeout,omitempty"` // 超时时间（秒），为0时使用默认值
+	Targets json.RawMessage `json:"targets,omitempty"` // 自定义目标列表，格式同 -targets 的JSON文件
+}
+
+// testRun 一次检测任务
+type testRun struct {
+	ID       string                    `json:"id"`
+	Status   string                    `json:"status"`
+	IPv6     bool                      `json:"ipv6"`
+	Targets  int                       `json:"targets"` // 目标数量，0 表示使用内置目标
+	Created  time.Time                 `json:"created"`
+	Finished *time.Time                `json:"finished,omitempty"`
+	Results  []*backtrace.TargetResult `json:"results,omitempty"`
+}
+
+// server 本地HTTP API服务，所有检测任务共用同一个长期存在的Tracer
+type server struct {
+	tracer        *backtrace.Tracer
+	rules         *rules.RuleSet
+	db            *asndb.DB
+	maxRunning    int
+	keep          int            // 保留的任务数量，超出时丢弃最早完成的任务
+	targetsSource string         // 用于匹配备选地址的ICMP目标数据来源
+	reverseDNS    *rdns.Resolver // 非空时反向解析节点地址，缓存在所有任务间共用
+	geoIP         *geoip.DB
+	attempts      int // 每个目标并发追踪的次数
+	run           func(context.Context, backtrace.Options) []*backtrace.TargetResult
+
+	mu      sync.Mutex
+	runs    map[string]*testRun
+	order   []string
+	running int
+}
+
+func newServer(tracer *backtrace.Tracer, lineRules *rules.RuleSet, db *asndb.DB, maxRunning int) *server {
+	return &server{
+		tracer:     tracer,
+		rules:      lineRules,
+		db:         db,
+		maxRunning: maxRunning,
+		keep:       100,
+		run:        backtrace.BackTraceContext,
+		runs:       make(map[string]*testRun),
+	}
+}
+
+// serveMain backtrace serve 子命令
+func serveMain(args []string) {
+	var listen string
+	var maxRunning int
+	var probe probeOptions
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.StringVar(&listen, "listen", ":8080", "Listen address of the HTTP API")
+	fs.IntVar(&maxRunning, "max-running", 2, "Maximum number of tests running at the same time")
+	fs.BoolVar(&model.EnableLoger, "log", false, "Enable logging")
+	probe.register(fs)
+	fs.Parse(args)
+	config, err := probe.tracerConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	lineRules, db, geo := probe.mustLoad()
+	s := newServer(&backtrace.Tracer{Config: config}, lineRules, db, maxRunning)
+	s.targetsSource = probe.targetsSource
+	s.reverseDNS = probe.reverseDNS()
+	s.geoIP = geo
+	s.attempts = probe.attempts
+	fmt.Fprintf(os.Stderr, "backtrace API listening on %s\n", listen)
+	if err := http.ListenAndServe(listen, s.handler()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// handler 返回API路由：
+//
+//	POST /api/tests               启动检测，返回任务信息
+//	GET  /api/tests               列出任务
+//	GET  /api/tests/{id}          查询任务状态
+//	GET  /api/tests/{id}/results  获取检测结果
+//	GET  /healthz                 健康检查
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/tests", s.handleStart)
+	mux.HandleFunc("GET /api/tests", s.handleList)
+	mux.HandleFunc("GET /api/tests/{id}", s.handleStatus)
+	mux.HandleFunc("GET /api/tests/{id}/results", s.handleResults)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "version": model.BackTraceVersion})
+	})
+	return mux
+}
+
+func (s *server) handleStart(w http.ResponseWriter, r *http.Request) {
+	var req testRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+	}
+	opts := backtrace.Options{
+		EnableIPv6:    req.IPv6,
+		Timeout:       time.Duration(req.Timeout) * time.Second,
+		ASNDB:         s.db,
+		Tracer:        s.tracer,
+		Rules:         s.rules,
+		TargetsSource: s.targetsSource,
+		ReverseDNS:    s.reverseDNS,
+		GeoIP:         s.geoIP,
+		Trace:         backtrace.TraceOptions{Attempts: s.attempts},
+	}
+	if req.Timeout < 0 || opts.Timeout > maxTestTimeout {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("timeout must be between 0 and %d seconds", int(maxTestTimeout/time.Second)))
+		return
+	}
+	if len(req.Targets) > 0 {
+		targets, err := backtrace.ParseTargets(req.Targets, "json")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		opts.Targets = targets
+	}
+	s.mu.Lock()
+	if s.running >= s.maxRunning {
+		s.mu.Unlock()
+		writeError(w, http.StatusTooManyRequests, "too many tests running")
+		return
+	}
+	s.running++
+	run := &testRun{
+		ID:      newTestID(),
+		Status:  statusRunning,
+		IPv6:    req.IPv6,
+		Targets: len(opts.Targets),
+		Created: time.Now(),
+	}
+	s.runs[run.ID] = run
+	s.order = append(s.order, run.ID)
+	s.prune()
+	status := *run
+	s.mu.Unlock()
+	go func() {
+		results := s.run(context.Background(), opts)
+		now := time.Now()
+		s.mu.Lock()
+		run.Results = results
+		run.Status = statusDone
+		run.Finished = &now
+		s.running--
+		s.mu.Unlock()
+	}()
+	w.Header().Set("Location", "/api/tests/"+run.ID)
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+func (s *server) handleList(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	list := make([]testRun, 0, len(s.order))
+	for _, id := range s.order {
+		run := *s.runs[id]
+		run.Results = nil
+		list = append(list, run)
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.lookup(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "test not found")
+		return
+	}
+	run.Results = nil
+	writeJSON(w, http.StatusOK, run)
+}
+
+func (s *server) handleResults(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.lookup(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "test not found")
+		return
+	}
+	if run.Status != statusDone {
+		writeError(w, http.StatusConflict, "test is still running")
+		return
+	}
+	writeJSON(w, http.StatusOK, run.Results)
+}
+
+// lookup 返回任务的副本
+func (s *server) lookup(id string) (testRun, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.runs[id]
+	if !ok {
+		return testRun{}, false
+	}
+	return *run, true
+}
+
+// prune 丢弃超出保留数量的最早已完成任务，调用时需持有锁
+func (s *server) prune() {
+	for i := 0; len(s.order) > s.keep && i < len(s.order); {
+		id := s.order[i]
+		if s.runs[id].Status != statusDone {
+			i++
+			continue
+		}
+		delete(s.runs, id)
+		s.order = append(s.order[:i], s.order[i+1:]...)
+	}
+}
+
+func newTestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
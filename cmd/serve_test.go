@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	backtrace "github.com/oneclickvirt/backtrace/bk"
+)
+
+func TestServer(t *testing.T) {
+	release := make(chan struct{})
+	s := newServer(&backtrace.Tracer{}, nil, nil, 1)
+	var got backtrace.Options
+	s.run = func(ctx context.Context, opts backtrace.Options) []*backtrace.TargetResult {
+		got = opts
+		<-release
+		return []*backtrace.TargetResult{{Name: opts.Targets[0].Name, IP: opts.Targets[0].IP}}
+	}
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+
+	post := func(body string) *http.Response {
+		resp, err := http.Post(ts.URL+"/api/tests", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	get := func(path string, v interface{}) int {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if v != nil {
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	if resp := post(`{"targets": [{"ip": "not-an-ip"}]}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid target: status %d", resp.StatusCode)
+	}
+	resp := post(`{"ipv6": true, "timeout": 30, "targets": [{"name": "test", "ip": "198.51.100.7"}]}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("start: status %d", resp.StatusCode)
+	}
+	var run testRun
+	if err := json.NewDecoder(resp.Body).Decode(&run); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if run.ID == "" || run.Status != statusRunning || resp.Header.Get("Location") != "/api/tests/"+run.ID {
+		t.Fatalf("unexpected run %+v", run)
+	}
+	// 超过并发上限时拒绝新的检测
+	if resp := post(`{}`); resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("second test: status %d", resp.StatusCode)
+	}
+	if code := get("/api/tests/"+run.ID+"/results", nil); code != http.StatusConflict {
+		t.Errorf("results while running: status %d", code)
+	}
+	close(release)
+	for run.Status != statusDone {
+		if code := get("/api/tests/"+run.ID, &run); code != http.StatusOK {
+			t.Fatalf("status: %d", code)
+		}
+	}
+	if got.Tracer != s.tracer || !got.EnableIPv6 || got.Timeout.Seconds() != 30 {
+		t.Errorf("unexpected options %+v", got)
+	}
+	var results []*backtrace.TargetResult
+	if code := get("/api/tests/"+run.ID+"/results", &results); code != http.StatusOK || len(results) != 1 || results[0].IP != "198.51.100.7" {
+		t.Errorf("results: status %d, %+v", code, results)
+	}
+	var list []testRun
+	if code := get("/api/tests", &list); code != http.StatusOK || len(list) != 1 || list[0].Results != nil {
+		t.Errorf("list: status %d, %+v", code, list)
+	}
+	if code := get("/api/tests/unknown", nil); code != http.StatusNotFound {
+		t.Errorf("unknown test: status %d", code)
+	}
+}
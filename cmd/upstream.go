@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/oneclickvirt/backtrace/asndb"
+	"github.com/oneclickvirt/backtrace/asrel"
+	"github.com/oneclickvirt/backtrace/bgptools"
+)
+
+// newUpstreamProvider 根据 -upstream 选择上游查询方式
+func newUpstreamProvider(name, asRelFile string, db *asndb.DB) (bgptools.UpstreamProvider, error) {
+	switch name {
+	case bgptools.ProviderBGPTools:
+		return &bgptools.BGPTools{}, nil
+	case bgptools.ProviderRIPEstat:
+		return &bgptools.RIPEstat{}, nil
+	case bgptools.ProviderCAIDA:
+		if asRelFile == "" || db == nil {
+			return nil, fmt.Errorf("-upstream caida requires -as-rel and -asn-db")
+		}
+		graph, err := asrel.Open(asRelFile)
+		if err != nil {
+			return nil, fmt.Errorf("load AS relationships: %w", err)
+		}
+		return &bgptools.CAIDA{Graph: graph, ASNDB: db}, nil
+	}
+	return nil, fmt.Errorf("unsupported upstream provider: %s", name)
+}
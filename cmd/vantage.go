@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+
+	"github.com/oneclickvirt/backtrace/geoip"
+	"github.com/oneclickvirt/backtrace/vantage"
+)
+
+// detectVantage 查询本机的公网地址及位置。指定了地理位置数据库时位置由数据库提供，
+// 此时只查询地址，ip 非空时直接使用该地址
+func detectVantage(geo *geoip.DB, ip string) (*vantage.Info, error) {
+	ctx := context.Background()
+	if geo == nil {
+		return (&vantage.Detector{}).Detect(ctx)
+	}
+	info := &vantage.Info{IP: ip}
+	if ip == "" {
+		var err error
+		info, err = (&vantage.Detector{Providers: vantage.AddressProviders()}).Detect(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	addr, err := netip.ParseAddr(info.IP)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IP address: %s", info.IP)
+	}
+	if addr.Is4() {
+		info.IPv4 = addr.String()
+	} else {
+		info.IPv6 = addr.String()
+	}
+	loc, ok := geo.Lookup(addr)
+	if !ok {
+		return nil, fmt.Errorf("%s not found in the geoip database", info.IP)
+	}
+	info.Country, info.Region, info.City = loc.Country, loc.Region, loc.City
+	if loc.Latitude != nil {
+		info.Loc = fmt.Sprintf("%.4f,%.4f", *loc.Latitude, *loc.Longitude)
+	}
+	// 与 ipinfo.io 的格式一致
+	if loc.ASN != 0 {
+		info.Org = fmt.Sprintf("AS%d %s", loc.ASN, loc.Org)
+	}
+	info.Sources = append(info.Sources, "geoip")
+	return info, nil
+}
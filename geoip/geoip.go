@@ -0,0 +1,160 @@
+// Package geoip 读取本地 MaxMind 格式（.mmdb）数据库，离线查询地址的国家、城市、坐标及ASN，
+// 支持 GeoLite2/GeoIP2 City、Country、ASN 及字段结构兼容的数据库（如 DB-IP Lite）
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Location 地址的位置信息，各字段均可能为空
+type Location struct {
+	Country     string   `json:"country,omitempty"`      // ISO 3166-1 二字母国家代码
+	CountryName string   `json:"country_name,omitempty"` // 国家名称
+	Region      string   `json:"region,omitempty"`       // 一级行政区，如省、州
+	City        string   `json:"city,omitempty"`
+	Latitude    *float64 `json:"latitude,omitempty"`
+	Longitude   *float64 `json:"longitude,omitempty"`
+	ASN         uint32   `json:"asn,omitempty"` // 仅ASN数据库提供
+	Org         string   `json:"org,omitempty"` // AS所属组织，仅ASN数据库提供
+}
+
+// String 返回 "城市, 地区, 国家代码" 形式的位置
+func (l *Location) String() string {
+	if l == nil {
+		return ""
+	}
+	var parts []string
+	if l.City != "" {
+		parts = append(parts, l.City)
+	}
+	// 直辖市等城市与地区同名
+	if l.Region != "" && l.Region != l.City {
+		parts = append(parts, l.Region)
+	}
+	if l.Country != "" {
+		parts = append(parts, l.Country)
+	}
+	return strings.Join(parts, ", ")
+}
+
+type names map[string]string
+
+// record 数据库中单条记录的字段，City/Country 与 ASN 数据库的字段合并在一起
+type record struct {
+	City struct {
+		Names names `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+		Names   names  `maxminddb:"names"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+		Names   names  `maxminddb:"names"`
+	} `maxminddb:"registered_country"`
+	Subdivisions []struct {
+		Names names `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	Location struct {
+		Latitude  *float64 `maxminddb:"latitude"`
+		Longitude *float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+	ASN uint32 `maxminddb:"autonomous_system_number"`
+	Org string `maxminddb:"autonomous_system_organization"`
+}
+
+// DB 一个或多个 .mmdb 数据库，查询结果按打开顺序合并
+type DB struct {
+	Language string // 名称的语言，如 zh-CN，没有该语言时使用英文；为空时使用英文
+	readers  []*maxminddb.Reader
+}
+
+// Open 打开一个或多个数据库文件，如同时打开 City 和 ASN 数据库
+func Open(paths ...string) (*DB, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no database file")
+	}
+	db := &DB{}
+	for _, path := range paths {
+		r, err := maxminddb.Open(path)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		db.readers = append(db.readers, r)
+	}
+	return db, nil
+}
+
+// Close 关闭所有数据库文件
+func (db *DB) Close() error {
+	var errs []error
+	for _, r := range db.readers {
+		errs = append(errs, r.Close())
+	}
+	db.readers = nil
+	return errors.Join(errs...)
+}
+
+// Lookup 查询地址的位置，所有数据库中都没有记录时返回false
+func (db *DB) Lookup(addr netip.Addr) (*Location, bool) {
+	if db == nil || !addr.IsValid() {
+		return nil, false
+	}
+	ip := net.IP(addr.Unmap().AsSlice())
+	loc := &Location{}
+	found := false
+	for _, r := range db.readers {
+		var rec record
+		// IPv4数据库中查询IPv6地址会返回错误，视为没有记录
+		if _, ok, err := r.LookupNetwork(ip, &rec); err != nil || !ok {
+			continue
+		}
+		found = true
+		db.merge(loc, &rec)
+	}
+	if !found || *loc == (Location{}) {
+		return nil, false
+	}
+	return loc, true
+}
+
+// merge 将记录中的字段填入 loc 中仍为空的字段
+func (db *DB) merge(loc *Location, rec *record) {
+	country, countryNames := rec.Country.ISOCode, rec.Country.Names
+	if country == "" {
+		country, countryNames = rec.RegisteredCountry.ISOCode, rec.RegisteredCountry.Names
+	}
+	set := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+	set(&loc.Country, country)
+	set(&loc.CountryName, db.name(countryNames))
+	if len(rec.Subdivisions) > 0 {
+		set(&loc.Region, db.name(rec.Subdivisions[0].Names))
+	}
+	set(&loc.City, db.name(rec.City.Names))
+	set(&loc.Org, rec.Org)
+	if loc.Latitude == nil && rec.Location.Latitude != nil && rec.Location.Longitude != nil {
+		loc.Latitude, loc.Longitude = rec.Location.Latitude, rec.Location.Longitude
+	}
+	if loc.ASN == 0 {
+		loc.ASN = rec.ASN
+	}
+}
+
+// name 按 Language 选择名称
+func (db *DB) name(n names) string {
+	if name := n[db.Language]; db.Language != "" && name != "" {
+		return name
+	}
+	return n["en"]
+}
@@ -0,0 +1,230 @@
+package geoip
+
+import (
+	"encoding/binary"
+	"math"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// mmdbWriter 为测试生成最小的 MaxMind 数据库：IPv6搜索树，记录长度24位，IPv4地址位于 ::/96
+type mmdbWriter struct {
+	nodes [][2]int // 大于等于0为子节点，-1为空，小于等于-2为数据偏移 -(offset+2)
+	data  []byte
+}
+
+func (w *mmdbWriter) insert(prefix string, value map[string]any) {
+	p := netip.MustParsePrefix(prefix)
+	var ip [16]byte
+	bits := p.Bits()
+	if p.Addr().Is4() {
+		v4 := p.Addr().As4()
+		copy(ip[12:], v4[:])
+		bits += 96
+	} else {
+		ip = p.Addr().As16()
+	}
+	marker := -(len(w.data) + 2)
+	w.data = append(w.data, encodeValue(value)...)
+	if len(w.nodes) == 0 {
+		w.nodes = append(w.nodes, [2]int{-1, -1})
+	}
+	cur := 0
+	for i := 0; i < bits; i++ {
+		bit := int(ip[i/8]>>(7-i%8)) & 1
+		if i == bits-1 {
+			w.nodes[cur][bit] = marker
+			break
+		}
+		if w.nodes[cur][bit] == -1 {
+			w.nodes = append(w.nodes, [2]int{-1, -1})
+			w.nodes[cur][bit] = len(w.nodes) - 1
+		}
+		cur = w.nodes[cur][bit]
+	}
+}
+
+func (w *mmdbWriter) write(t *testing.T, name, dbType string) string {
+	t.Helper()
+	n := len(w.nodes)
+	var out []byte
+	for _, node := range w.nodes {
+		for _, rec := range node {
+			v := rec
+			switch {
+			case rec == -1:
+				v = n
+			case rec <= -2:
+				v = n + 16 + (-rec - 2)
+			}
+			out = append(out, byte(v>>16), byte(v>>8), byte(v))
+		}
+	}
+	out = append(out, make([]byte, 16)...)
+	out = append(out, w.data...)
+	out = append(out, "\xab\xcd\xefMaxMind.com"...)
+	out = append(out, encodeValue(map[string]any{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1700000000),
+		"database_type":               dbType,
+		"description":                 map[string]any{"en": "test database"},
+		"ip_version":                  uint16(6),
+		"languages":                   []any{"en", "zh-CN"},
+		"node_count":                  uint32(n),
+		"record_size":                 uint16(24),
+	})...)
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, out, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// control 编码控制字节，类型大于7时使用扩展类型
+func control(typ, size int) []byte {
+	var b []byte
+	first := byte(typ << 5)
+	if typ > 7 {
+		first = 0
+	}
+	switch {
+	case size < 29:
+		b = append(b, first|byte(size))
+	case size < 29+256:
+		b = append(b, first|29)
+	default:
+		b = append(b, first|30)
+	}
+	if typ > 7 {
+		b = append(b, byte(typ-7))
+	}
+	switch {
+	case size < 29:
+	case size < 29+256:
+		b = append(b, byte(size-29))
+	default:
+		b = append(b, byte((size-285)>>8), byte(size-285))
+	}
+	return b
+}
+
+func encodeUint(typ int, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	i := 0
+	for i < 8 && buf[i] == 0 {
+		i++
+	}
+	return append(control(typ, 8-i), buf[i:]...)
+}
+
+func encodeValue(v any) []byte {
+	switch v := v.(type) {
+	case string:
+		return append(control(2, len(v)), v...)
+	case float64:
+		b := control(3, 8)
+		return binary.BigEndian.AppendUint64(b, math.Float64bits(v))
+	case uint16:
+		return encodeUint(5, uint64(v))
+	case uint32:
+		return encodeUint(6, uint64(v))
+	case uint64:
+		return encodeUint(9, v)
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b := control(7, len(v))
+		for _, k := range keys {
+			b = append(b, encodeValue(k)...)
+			b = append(b, encodeValue(v[k])...)
+		}
+		return b
+	case []any:
+		b := control(11, len(v))
+		for _, e := range v {
+			b = append(b, encodeValue(e)...)
+		}
+		return b
+	}
+	panic("unsupported type")
+}
+
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+	city := &mmdbWriter{}
+	city.insert("1.0.0.0/24", map[string]any{
+		"city":         map[string]any{"names": map[string]any{"en": "Guangzhou", "zh-CN": "广州"}},
+		"country":      map[string]any{"iso_code": "CN", "names": map[string]any{"en": "China", "zh-CN": "中国"}},
+		"location":     map[string]any{"latitude": 23.1167, "longitude": 113.25},
+		"subdivisions": []any{map[string]any{"names": map[string]any{"en": "Guangdong"}}},
+	})
+	city.insert("2001:db8::/32", map[string]any{
+		"city":    map[string]any{"names": map[string]any{"en": "Tokyo"}},
+		"country": map[string]any{"iso_code": "JP", "names": map[string]any{"en": "Japan"}},
+	})
+	city.insert("8.8.8.0/24", map[string]any{
+		"registered_country": map[string]any{"iso_code": "US", "names": map[string]any{"en": "United States"}},
+	})
+	asn := &mmdbWriter{}
+	asn.insert("1.0.0.0/16", map[string]any{
+		"autonomous_system_number":       uint32(4134),
+		"autonomous_system_organization": "CHINANET-BACKBONE",
+	})
+	db, err := Open(city.write(t, "city.mmdb", "GeoLite2-City"), asn.write(t, "asn.mmdb", "GeoLite2-ASN"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestLookup(t *testing.T) {
+	db := openTestDB(t)
+	loc, ok := db.Lookup(netip.MustParseAddr("1.0.0.1"))
+	if !ok {
+		t.Fatal("1.0.0.1 not found")
+	}
+	if loc.String() != "Guangzhou, Guangdong, CN" || loc.CountryName != "China" || loc.ASN != 4134 || loc.Org != "CHINANET-BACKBONE" {
+		t.Errorf("1.0.0.1 = %+v", loc)
+	}
+	if loc.Latitude == nil || *loc.Latitude != 23.1167 || *loc.Longitude != 113.25 {
+		t.Errorf("coordinates = %v, %v", loc.Latitude, loc.Longitude)
+	}
+	// 只在ASN数据库中的地址
+	if loc, ok := db.Lookup(netip.MustParseAddr("::ffff:1.0.200.1")); !ok || loc.ASN != 4134 || loc.Country != "" {
+		t.Errorf("1.0.200.1 = %+v, %v", loc, ok)
+	}
+	if loc, ok := db.Lookup(netip.MustParseAddr("2001:db8::1")); !ok || loc.String() != "Tokyo, JP" {
+		t.Errorf("2001:db8::1 = %+v, %v", loc, ok)
+	}
+	// 没有 country 时使用 registered_country
+	if loc, ok := db.Lookup(netip.MustParseAddr("8.8.8.8")); !ok || loc.Country != "US" {
+		t.Errorf("8.8.8.8 = %+v, %v", loc, ok)
+	}
+	if loc, ok := db.Lookup(netip.MustParseAddr("9.9.9.9")); ok {
+		t.Errorf("9.9.9.9 = %+v", loc)
+	}
+	db.Language = "zh-CN"
+	if loc, _ := db.Lookup(netip.MustParseAddr("1.0.0.1")); loc.City != "广州" || loc.Region != "Guangdong" {
+		t.Errorf("zh-CN names = %+v", loc)
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	if _, err := Open(); err == nil {
+		t.Error("Open without files did not fail")
+	}
+	path := filepath.Join(t.TempDir(), "invalid.mmdb")
+	os.WriteFile(path, []byte("not a database"), 0o644)
+	if _, err := Open(path); err == nil {
+		t.Error("invalid database did not fail")
+	}
+}
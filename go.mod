@@ -6,8 +6,10 @@ require (
 	github.com/google/uuid v1.6.0
 	github.com/imroc/req/v3 v3.54.0
 	github.com/oneclickvirt/defaultset v0.0.0-20240624051018-30a50859e1b5
+	github.com/oschwald/maxminddb-golang v1.13.1
 	golang.org/x/net v0.41.0
 	golang.org/x/sys v0.33.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,256 @@
+// Package icmpdata 获取用于匹配备选地址的 ICMP 目标数据（spiritLHLS/icmp_targets 的 nodes.json），
+// 数据缓存在磁盘上并通过 ETag/Last-Modified 重新验证，无法联网且没有缓存时使用内置快照
+package icmpdata
+
+import (
+	"context"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/oneclickvirt/backtrace/model"
+)
+
+// DefaultSource 默认的数据地址
+const DefaultSource = "https://raw.githubusercontent.com/spiritLHLS/icmp_targets/main/nodes.json"
+
+// DefaultMaxAge 磁盘缓存在该时间内直接使用，不再向服务器验证
+const DefaultMaxAge = time.Hour
+
+// 数据的实际来源
+const (
+	OriginFile        = "file"        // 本地文件
+	OriginNetwork     = "network"     // 从网络下载
+	OriginCache       = "cache"       // 未过期的磁盘缓存
+	OriginRevalidated = "revalidated" // 服务器确认未修改的磁盘缓存
+	OriginStale       = "stale"       // 无法联网时使用的过期磁盘缓存
+	OriginSnapshot    = "snapshot"    // 内置快照
+)
+
+// nodes.json 为内置快照，格式与上游文件相同，可直接用上游文件替换更新
+//
+//go:embed nodes.json
+var snapshot []byte
+
+// Data 加载得到的ICMP目标数据
+type Data struct {
+	Targets []model.IcmpTarget
+	Origin  string // 见 OriginFile 等
+	Version string // 数据版本，网络数据为 ETag 或 Last-Modified，内置快照为 snapshot
+}
+
+// Loader 加载ICMP目标数据，零值使用默认地址、默认缓存目录及CDN镜像
+type Loader struct {
+	// Source 本地文件路径或 http(s) 地址，为空时使用 DefaultSource
+	Source string
+	// Mirrors 镜像前缀，请求时拼接在地址前，优先于直连依次尝试；
+	// 为nil且 Source 为空时使用 model.CdnList
+	Mirrors []string
+	// CacheDir 磁盘缓存目录，为空时使用用户缓存目录下的 backtrace
+	CacheDir string
+	// MaxAge 缓存在该时间内直接使用，为0时使用 DefaultMaxAge
+	MaxAge time.Duration
+	// Client 发送请求的客户端，为nil时使用超时6秒的默认客户端
+	Client *http.Client
+}
+
+// cacheMeta 磁盘缓存的元数据
+type cacheMeta struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+}
+
+// Snapshot 返回内置快照中的数据
+func Snapshot() *Data {
+	var targets []model.IcmpTarget
+	_ = json.Unmarshal(snapshot, &targets)
+	return &Data{Targets: targets, Origin: OriginSnapshot, Version: OriginSnapshot}
+}
+
+// Load 按 Source 加载数据：本地文件直接读取；网络地址优先使用未过期的磁盘缓存，
+// 过期后带条件请求重新验证，所有请求失败时使用过期缓存，没有缓存时使用内置快照。
+// 只有本地文件无法读取或解析时返回错误，此时同时返回内置快照
+func (l *Loader) Load(ctx context.Context) (*Data, error) {
+	source := l.Source
+	if source == "" {
+		source = DefaultSource
+	}
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		b, err := os.ReadFile(source)
+		if err == nil {
+			var targets []model.IcmpTarget
+			if targets, err = parse(b); err == nil {
+				return &Data{Targets: targets, Origin: OriginFile, Version: source}, nil
+			}
+		}
+		return Snapshot(), fmt.Errorf("读取ICMP目标数据失败: %w", err)
+	}
+	dataFile, metaFile := l.cacheFiles(source)
+	cached, meta := readCache(dataFile, metaFile, source)
+	maxAge := l.MaxAge
+	if maxAge <= 0 {
+		maxAge = DefaultMaxAge
+	}
+	if cached != nil && time.Since(meta.Fetched) < maxAge {
+		return &Data{Targets: cached, Origin: OriginCache, Version: meta.version()}, nil
+	}
+	for _, url := range l.candidates(source) {
+		body, header, status, err := l.fetch(ctx, url, cached != nil, meta)
+		if err != nil {
+			continue
+		}
+		if status == http.StatusNotModified {
+			meta.Fetched = time.Now()
+			writeMeta(metaFile, meta)
+			return &Data{Targets: cached, Origin: OriginRevalidated, Version: meta.version()}, nil
+		}
+		targets, err := parse(body)
+		if err != nil {
+			continue
+		}
+		meta = &cacheMeta{
+			URL:          source,
+			ETag:         header.Get("ETag"),
+			LastModified: header.Get("Last-Modified"),
+			Fetched:      time.Now(),
+		}
+		if dataFile != "" && os.MkdirAll(filepath.Dir(dataFile), 0o755) == nil &&
+			os.WriteFile(dataFile, body, 0o644) == nil {
+			writeMeta(metaFile, meta)
+		}
+		return &Data{Targets: targets, Origin: OriginNetwork, Version: meta.version()}, nil
+	}
+	if cached != nil {
+		return &Data{Targets: cached, Origin: OriginStale, Version: meta.version()}, nil
+	}
+	return Snapshot(), nil
+}
+
+// candidates 返回依次尝试的请求地址
+func (l *Loader) candidates(source string) []string {
+	mirrors := l.Mirrors
+	if mirrors == nil && l.Source == "" {
+		mirrors = model.CdnList
+	}
+	urls := make([]string, 0, len(mirrors)+1)
+	for _, m := range mirrors {
+		urls = append(urls, m+source)
+	}
+	return append(urls, source)
+}
+
+// fetch 发送请求，conditional 为true时附带缓存的验证信息
+func (l *Loader) fetch(ctx context.Context, url string, conditional bool, meta *cacheMeta) ([]byte, http.Header, int, error) {
+	client := l.Client
+	if client == nil {
+		client = &http.Client{Timeout: 6 * time.Second}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if conditional {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		if conditional {
+			return nil, resp.Header, resp.StatusCode, nil
+		}
+		fallthrough
+	default:
+		return nil, nil, 0, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	return body, resp.Header, resp.StatusCode, err
+}
+
+// cacheFiles 返回地址对应的缓存文件及元数据文件，无法确定缓存目录时返回空字符串
+func (l *Loader) cacheFiles(source string) (string, string) {
+	dir := l.CacheDir
+	if dir == "" {
+		userDir, err := os.UserCacheDir()
+		if err != nil {
+			return "", ""
+		}
+		dir = filepath.Join(userDir, "backtrace")
+	}
+	sum := sha256.Sum256([]byte(source))
+	name := filepath.Join(dir, "icmp-targets-"+hex.EncodeToString(sum[:8]))
+	return name + ".json", name + ".meta.json"
+}
+
+// readCache 读取缓存，缓存不存在、已损坏或不属于 source 时返回空数据
+func readCache(dataFile, metaFile, source string) ([]model.IcmpTarget, *cacheMeta) {
+	meta := &cacheMeta{URL: source}
+	if dataFile == "" {
+		return nil, meta
+	}
+	b, err := os.ReadFile(metaFile)
+	if err != nil {
+		return nil, meta
+	}
+	var stored cacheMeta
+	if json.Unmarshal(b, &stored) != nil || stored.URL != source {
+		return nil, meta
+	}
+	b, err = os.ReadFile(dataFile)
+	if err != nil {
+		return nil, meta
+	}
+	targets, err := parse(b)
+	if err != nil {
+		return nil, meta
+	}
+	return targets, &stored
+}
+
+func writeMeta(metaFile string, meta *cacheMeta) {
+	if metaFile == "" {
+		return
+	}
+	if b, err := json.Marshal(meta); err == nil {
+		_ = os.WriteFile(metaFile, b, 0o644)
+	}
+}
+
+func (m *cacheMeta) version() string {
+	if m.ETag != "" {
+		return m.ETag
+	}
+	return m.LastModified
+}
+
+// parse 解析数据，空列表视为错误，避免错误页面覆盖可用的缓存
+func parse(b []byte) ([]model.IcmpTarget, error) {
+	var targets []model.IcmpTarget
+	if err := json.Unmarshal(b, &targets); err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, errors.New("ICMP目标数据为空")
+	}
+	return targets, nil
+}
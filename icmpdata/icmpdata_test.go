@@ -0,0 +1,102 @@
+package icmpdata
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const nodes = `[{"province": "浙江", "isp": "电信", "ip_version": "v4", "ips": "60.191.244.5,115.236.12.1"}]`
+
+func TestLoadRevalidate(t *testing.T) {
+	var requests, conditional int
+	online := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !online {
+			http.Error(w, "offline", http.StatusBadGateway)
+			return
+		}
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(nodes))
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+	l := &Loader{Source: srv.URL + "/nodes.json", CacheDir: t.TempDir()}
+
+	load := func(origin string) {
+		t.Helper()
+		data, err := l.Load(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data.Origin != origin || len(data.Targets) != 1 || data.Targets[0].Province != "浙江" {
+			t.Fatalf("got %s %+v, want origin %s", data.Origin, data.Targets, origin)
+		}
+		if data.Version != `"v1"` {
+			t.Errorf("version = %q", data.Version)
+		}
+	}
+	load(OriginNetwork)
+	// 未过期的缓存不发送请求
+	load(OriginCache)
+	if requests != 1 {
+		t.Errorf("%d requests, want 1", requests)
+	}
+	// 过期后带 If-None-Match 重新验证
+	l.MaxAge = time.Nanosecond
+	load(OriginRevalidated)
+	if conditional != 1 {
+		t.Errorf("%d conditional requests, want 1", conditional)
+	}
+	online = false
+	load(OriginStale)
+}
+
+func TestLoadFallback(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+	// 无法获得有效数据且没有缓存时使用内置快照
+	l := &Loader{Source: srv.URL, CacheDir: t.TempDir()}
+	data, err := l.Load(ctx)
+	if err != nil || data.Origin != OriginSnapshot || len(data.Targets) == 0 {
+		t.Fatalf("got %+v, %v", data, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "nodes.json")
+	if err := os.WriteFile(path, []byte(nodes), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l = &Loader{Source: path}
+	if data, err := l.Load(ctx); err != nil || data.Origin != OriginFile || len(data.Targets) != 1 {
+		t.Errorf("local file: %+v, %v", data, err)
+	}
+	l.Source = filepath.Join(t.TempDir(), "missing.json")
+	if data, err := l.Load(ctx); err == nil || data.Origin != OriginSnapshot {
+		t.Errorf("missing file: %+v, %v", data, err)
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	l := &Loader{}
+	urls := l.candidates(DefaultSource)
+	if len(urls) < 2 || urls[len(urls)-1] != DefaultSource || urls[0] == DefaultSource {
+		t.Errorf("default source should be tried through mirrors first: %v", urls)
+	}
+	l.Source = "https://mirror.example/nodes.json"
+	if urls := l.candidates(l.Source); len(urls) != 1 {
+		t.Errorf("custom source should not use default mirrors: %v", urls)
+	}
+}
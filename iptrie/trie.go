@@ -0,0 +1,168 @@
+// Package iptrie 提供基于路径压缩二叉前缀树的最长前缀匹配表，同时支持 IPv4 和 IPv6
+package iptrie
+
+import (
+	"net/netip"
+)
+
+// Table 前缀到值的映射表，查询时返回覆盖地址的最长前缀对应的值。
+// Table 的零值可直接使用，写入与查询不能并发进行。
+type Table[V any] struct {
+	roots [2]*node[V] // 0 为 IPv4，1 为 IPv6
+	size  int
+}
+
+type node[V any] struct {
+	key   [16]byte // 已按 bits 掩码的地址，IPv4 仅使用前4个字节
+	bits  int
+	val   V
+	ok    bool
+	child [2]*node[V]
+}
+
+// addrKey 将地址转换为树中使用的键及其所属地址族，IPv4映射的IPv6地址按IPv4处理
+func addrKey(addr netip.Addr) (key [16]byte, family int, maxBits int) {
+	addr = addr.Unmap()
+	if addr.Is4() {
+		a := addr.As4()
+		copy(key[:], a[:])
+		return key, 0, 32
+	}
+	return addr.As16(), 1, 128
+}
+
+func bitAt(k *[16]byte, i int) int {
+	return int(k[i/8]>>(7-uint(i%8))) & 1
+}
+
+// commonBits 返回 a 和 b 前 max 位中相同的前导位数
+func commonBits(a, b *[16]byte, max int) int {
+	n := 0
+	for i := 0; i < 16 && n < max; i++ {
+		x := a[i] ^ b[i]
+		if x == 0 {
+			n += 8
+			continue
+		}
+		for x&0x80 == 0 {
+			n++
+			x <<= 1
+		}
+		break
+	}
+	if n > max {
+		n = max
+	}
+	return n
+}
+
+// maskKey 保留前 bits 位，其余置零
+func maskKey(k [16]byte, bits int) [16]byte {
+	for i := 0; i < 16; i++ {
+		switch {
+		case bits >= 8:
+			bits -= 8
+		case bits > 0:
+			k[i] &= ^byte(0xff >> uint(bits))
+			bits = 0
+		default:
+			k[i] = 0
+		}
+	}
+	return k
+}
+
+// Insert 写入前缀及其对应的值，前缀已存在时覆盖原值
+func (t *Table[V]) Insert(prefix netip.Prefix, val V) {
+	if !prefix.IsValid() {
+		return
+	}
+	bits := prefix.Bits()
+	key, family, _ := addrKey(prefix.Addr())
+	if prefix.Addr().Is4In6() {
+		if bits < 96 {
+			return
+		}
+		bits -= 96
+	}
+	key = maskKey(key, bits)
+	p := &t.roots[family]
+	for {
+		cur := *p
+		if cur == nil {
+			*p = &node[V]{key: key, bits: bits, val: val, ok: true}
+			t.size++
+			return
+		}
+		c := commonBits(&cur.key, &key, min(cur.bits, bits))
+		switch {
+		case c == cur.bits && c == bits:
+			if !cur.ok {
+				t.size++
+			}
+			cur.val, cur.ok = val, true
+			return
+		case c == cur.bits:
+			// 当前节点是新前缀的父前缀，继续向下
+			p = &cur.child[bitAt(&key, c)]
+			continue
+		case c == bits:
+			// 新前缀是当前节点的父前缀
+			n := &node[V]{key: key, bits: bits, val: val, ok: true}
+			n.child[bitAt(&cur.key, c)] = cur
+			*p = n
+		default:
+			// 在分叉处插入不带值的分支节点
+			branch := &node[V]{key: maskKey(key, c), bits: c}
+			branch.child[bitAt(&key, c)] = &node[V]{key: key, bits: bits, val: val, ok: true}
+			branch.child[bitAt(&cur.key, c)] = cur
+			*p = branch
+		}
+		t.size++
+		return
+	}
+}
+
+// Lookup 返回覆盖 addr 的最长前缀对应的值
+func (t *Table[V]) Lookup(addr netip.Addr) (V, bool) {
+	_, val, ok := t.LookupPrefix(addr)
+	return val, ok
+}
+
+// LookupPrefix 返回覆盖 addr 的最长前缀及其对应的值
+func (t *Table[V]) LookupPrefix(addr netip.Addr) (netip.Prefix, V, bool) {
+	var zero V
+	if !addr.IsValid() {
+		return netip.Prefix{}, zero, false
+	}
+	key, family, maxBits := addrKey(addr)
+	var best *node[V]
+	for cur := t.roots[family]; cur != nil; {
+		if commonBits(&cur.key, &key, cur.bits) < cur.bits {
+			break
+		}
+		if cur.ok {
+			best = cur
+		}
+		if cur.bits >= maxBits {
+			break
+		}
+		cur = cur.child[bitAt(&key, cur.bits)]
+	}
+	if best == nil {
+		return netip.Prefix{}, zero, false
+	}
+	return netip.PrefixFrom(keyAddr(best.key, family), best.bits), best.val, true
+}
+
+func keyAddr(key [16]byte, family int) netip.Addr {
+	if family == 0 {
+		return netip.AddrFrom4([4]byte{key[0], key[1], key[2], key[3]})
+	}
+	return netip.AddrFrom16(key)
+}
+
+// Len 返回表中前缀的数量
+func (t *Table[V]) Len() int {
+	return t.size
+}
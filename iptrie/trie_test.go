@@ -0,0 +1,88 @@
+package iptrie
+
+import (
+	"math/rand"
+	"net/netip"
+	"testing"
+)
+
+func TestLongestPrefixMatch(t *testing.T) {
+	var table Table[string]
+	for prefix, val := range map[string]string{
+		"223.118.0.0/15":      "AS58453",
+		"223.120.0.0/15":      "AS58453",
+		"223.120.16.0/23":     "AS58807",
+		"223.120.19.0/24":     "AS58807",
+		"10.0.4.0/22":         "short",
+		"10.0.6.0/23":         "long",
+		"0.0.0.0/0":           "default4",
+		"2400:9380::/32":      "AS4134",
+		"2400:9380:9001::/48": "AS4809",
+		"240e::/20":           "AS4134",
+	} {
+		table.Insert(netip.MustParsePrefix(prefix), val)
+	}
+	cases := map[string]string{
+		"223.120.19.1":        "AS58807",
+		"223.120.190.1":       "AS58453", // 文本前缀 "223.120.19" 会误匹配
+		"223.120.17.254":      "AS58807",
+		"223.121.0.1":         "AS58453",
+		"10.0.5.1":            "short",
+		"10.0.7.1":            "long",
+		"10.0.8.1":            "default4",
+		"::ffff:223.120.19.1": "AS58807",
+		"2400:9380:9001::1":   "AS4809",
+		"2400:9380:9002::1":   "AS4134",
+		"240e:fff::1":         "AS4134",
+		"240f::1":             "",
+	}
+	for ip, want := range cases {
+		got, _ := table.Lookup(netip.MustParseAddr(ip))
+		if got != want {
+			t.Errorf("Lookup(%s) = %q, want %q", ip, got, want)
+		}
+	}
+	prefix, _, _ := table.LookupPrefix(netip.MustParseAddr("10.0.5.1"))
+	if prefix.String() != "10.0.4.0/22" {
+		t.Errorf("LookupPrefix(10.0.5.1) = %s", prefix)
+	}
+	if table.Len() != 10 {
+		t.Errorf("Len() = %d, want 10", table.Len())
+	}
+	table.Insert(netip.MustParsePrefix("10.0.6.0/23"), "replaced")
+	if v, _ := table.Lookup(netip.MustParseAddr("10.0.7.1")); v != "replaced" || table.Len() != 10 {
+		t.Errorf("overwrite failed: %q, Len() = %d", v, table.Len())
+	}
+}
+
+// TestAgainstLinearScan 与线性扫描的结果对比
+func TestAgainstLinearScan(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var table Table[int]
+	var prefixes []netip.Prefix
+	for i := 0; i < 2000; i++ {
+		var b [4]byte
+		r.Read(b[:])
+		p := netip.PrefixFrom(netip.AddrFrom4(b), 4+r.Intn(29)).Masked()
+		prefixes = append(prefixes, p)
+		table.Insert(p, i)
+	}
+	for i := 0; i < 5000; i++ {
+		var b [4]byte
+		r.Read(b[:])
+		addr := netip.AddrFrom4(b)
+		want, wantBits := -1, -1
+		for j, p := range prefixes {
+			if p.Contains(addr) && p.Bits() >= wantBits {
+				want, wantBits = j, p.Bits()
+			}
+		}
+		got, ok := table.Lookup(addr)
+		if !ok {
+			got = -1
+		}
+		if got != want {
+			t.Fatalf("Lookup(%s) = %d, want %d", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+// Package metrics 将周期性回程路由检测的结果以Prometheus文本格式导出，
+// 包括各目标识别出的线路、跳数、逐跳及端到端时延、丢包率以及线路变化次数
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	backtrace "github.com/oneclickvirt/backtrace/bk"
+)
+
+// Collector 保存最近一次检测的结果及历次检测间的线路变化次数
+type Collector struct {
+	mu       sync.Mutex
+	results  []*backtrace.TargetResult
+	runs     int
+	lastRun  time.Time
+	duration time.Duration
+	lines    map[targetKey]string  // 各目标上一次识别出的线路
+	changes  map[targetKey]float64 // 各目标的线路变化次数
+	order    []targetKey
+}
+
+type targetKey struct {
+	name, ip string
+}
+
+// New 创建空的Collector
+func New() *Collector {
+	return &Collector{
+		lines:   make(map[targetKey]string),
+		changes: make(map[targetKey]float64),
+	}
+}
+
+// Observe 记录一次检测的结果，识别出的线路与上一次不同时累加该目标的线路变化次数，
+// 超时或检测不到回程路由的结果不参与比较
+func (c *Collector) Observe(results []*backtrace.TargetResult, duration time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results = results
+	c.runs++
+	c.lastRun = time.Now()
+	c.duration = duration
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+		key := targetKey{r.Name, r.IP}
+		if _, ok := c.changes[key]; !ok {
+			c.changes[key] = 0
+			c.order = append(c.order, key)
+		}
+		if r.TimedOut || r.Reason == backtrace.ReasonTimeout || r.Reason == backtrace.ReasonNoRoute || r.Reason == backtrace.ReasonInternal {
+			continue
+		}
+		current := lineSignature(r.Lines)
+		if prev, ok := c.lines[key]; ok && prev != current {
+			c.changes[key]++
+		}
+		c.lines[key] = current
+	}
+}
+
+// lineSignature 将识别出的线路归一化为可比较的字符串
+func lineSignature(lines []backtrace.Line) string {
+	keys := make([]string, 0, len(lines))
+	for _, l := range lines {
+		keys = append(keys, l.Key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// ServeHTTP 以Prometheus文本格式输出指标
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = c.WriteTo(w)
+}
+
+// WriteTo 以Prometheus文本格式写出全部指标
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	c.write(&buf)
+	return buf.WriteTo(w)
+}
+
+func (c *Collector) write(buf *bytes.Buffer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := &writer{buf}
+	m.family("backtrace_runs_total", "counter", "Number of completed backtrace runs.")
+	m.sample("backtrace_runs_total", nil, float64(c.runs))
+	if c.runs > 0 {
+		m.family("backtrace_last_run_timestamp_seconds", "gauge", "Unix time the last run finished.")
+		m.sample("backtrace_last_run_timestamp_seconds", nil, float64(c.lastRun.UnixNano())/1e9)
+		m.family("backtrace_last_run_duration_seconds", "gauge", "Duration of the last run.")
+		m.sample("backtrace_last_run_duration_seconds", nil, c.duration.Seconds())
+	}
+
+	m.family("backtrace_target_line_info", "gauge", "Line detected on the return path of the target, one series per line.")
+	c.each(func(r *backtrace.TargetResult, labels []string) {
+		for _, l := range r.Lines {
+			m.sample("backtrace_target_line_info", append(labels, "key", l.Key, "line", l.Name, "asn", l.ASN, "tier", l.Tier), 1)
+		}
+	})
+	m.family("backtrace_target_line_changes_total", "counter", "Number of times the detected lines of the target changed between runs.")
+	for _, key := range c.order {
+		m.sample("backtrace_target_line_changes_total", []string{"target", key.name, "ip", key.ip}, c.changes[key])
+	}
+	m.family("backtrace_target_timed_out", "gauge", "Whether the last trace of the target ended early because of the timeout.")
+	c.each(func(r *backtrace.TargetResult, labels []string) {
+		m.sample("backtrace_target_timed_out", labels, boolValue(r.TimedOut))
+	})
+	m.family("backtrace_target_hops", "gauge", "Distance of the farthest responding hop.")
+	c.each(func(r *backtrace.TargetResult, labels []string) {
+		hops := 0
+		if n := len(r.Hops); n > 0 {
+			hops = r.Hops[n-1].Distance
+		}
+		m.sample("backtrace_target_hops", labels, float64(hops))
+	})
+	m.family("backtrace_target_rtt_seconds", "gauge", "Average round-trip time to the target, absent when it did not respond.")
+	c.each(func(r *backtrace.TargetResult, labels []string) {
+		if _, node := r.Destination(); node != nil {
+			_, avg, _ := node.RTTStats()
+			m.sample("backtrace_target_rtt_seconds", labels, avg.Seconds())
+		}
+	})
+	m.family("backtrace_target_loss_ratio", "gauge", "Ratio of probes to the target that got no reply.")
+	c.each(func(r *backtrace.TargetResult, labels []string) {
+		loss := 1.0
+		if hop, _ := r.Destination(); hop != nil {
+			loss = hop.Loss
+		}
+		m.sample("backtrace_target_loss_ratio", labels, loss)
+	})
+	m.family("backtrace_hop_rtt_seconds", "gauge", "Average round-trip time to a node on the return path.")
+	c.each(func(r *backtrace.TargetResult, labels []string) {
+		for _, h := range r.Hops {
+			for _, n := range h.Nodes {
+				_, avg, _ := n.RTTStats()
+				m.sample("backtrace_hop_rtt_seconds", append(labels, "hop", strconv.Itoa(h.Distance), "node", n.IP, "asn", n.ASN), avg.Seconds())
+			}
+		}
+	})
+	m.family("backtrace_hop_loss_ratio", "gauge", "Ratio of probes to a hop that got no reply.")
+	c.each(func(r *backtrace.TargetResult, labels []string) {
+		for _, h := range r.Hops {
+			m.sample("backtrace_hop_loss_ratio", append(labels, "hop", strconv.Itoa(h.Distance)), h.Loss)
+		}
+	})
+}
+
+// each 按检测顺序遍历最近一次的结果，labels 为目标的公共标签
+func (c *Collector) each(fn func(r *backtrace.TargetResult, labels []string)) {
+	for _, r := range c.results {
+		if r != nil {
+			fn(r, []string{"target", r.Name, "ip", r.IP})
+		}
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// writer 写出Prometheus文本格式
+type writer struct {
+	buf *bytes.Buffer
+}
+
+func (m *writer) family(name, typ, help string) {
+	fmt.Fprintf(m.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample 写出一个样本，labels 为交替的标签名和标签值
+func (m *writer) sample(name string, labels []string, value float64) {
+	m.buf.WriteString(name)
+	if len(labels) > 0 {
+		m.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				m.buf.WriteByte(',')
+			}
+			m.buf.WriteString(labels[i])
+			m.buf.WriteString(`="`)
+			m.buf.WriteString(labelEscaper.Replace(labels[i+1]))
+			m.buf.WriteByte('"')
+		}
+		m.buf.WriteByte('}')
+	}
+	m.buf.WriteByte(' ')
+	m.buf.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	m.buf.WriteByte('\n')
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	backtrace "github.com/oneclickvirt/backtrace/bk"
+)
+
+func result(lines ...string) *backtrace.TargetResult {
+	ms := time.Millisecond
+	r := &backtrace.TargetResult{
+		Name: "北京电信v4",
+		IP:   "219.141.140.10",
+		Hops: []*backtrace.HopResult{
+			{Distance: 2, Nodes: []*backtrace.NodeResult{{IP: "202.97.1.1", ASN: "AS4134", RTT: []time.Duration{10 * ms, 20 * ms}}}},
+			{Distance: 4, Nodes: []*backtrace.NodeResult{{IP: "219.141.140.10", RTT: []time.Duration{30 * ms}}}, Loss: 0.5},
+		},
+	}
+	for _, l := range lines {
+		r.Lines = append(r.Lines, backtrace.Line{Key: l, Name: l, ASN: "AS4134", Tier: "normal"})
+	}
+	return r
+}
+
+func TestCollector(t *testing.T) {
+	c := New()
+	c.Observe([]*backtrace.TargetResult{result("AS4809a")}, time.Second)
+	// 超时的结果不算作线路变化
+	timedOut := result()
+	timedOut.TimedOut = true
+	c.Observe([]*backtrace.TargetResult{timedOut}, time.Second)
+	c.Observe([]*backtrace.TargetResult{result("AS4134")}, 2*time.Second)
+
+	var b strings.Builder
+	if _, err := c.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	labels := `target="北京电信v4",ip="219.141.140.10"`
+	for _, want := range []string{
+		"# TYPE backtrace_runs_total counter\nbacktrace_runs_total 3\n",
+		"backtrace_last_run_duration_seconds 2\n",
+		`backtrace_target_line_info{` + labels + `,key="AS4134",line="AS4134",asn="AS4134",tier="normal"} 1` + "\n",
+		`backtrace_target_line_changes_total{` + labels + `} 1` + "\n",
+		`backtrace_target_timed_out{` + labels + `} 0` + "\n",
+		`backtrace_target_hops{` + labels + `} 4` + "\n",
+		`backtrace_target_rtt_seconds{` + labels + `} 0.03` + "\n",
+		`backtrace_target_loss_ratio{` + labels + `} 0.5` + "\n",
+		`backtrace_hop_rtt_seconds{` + labels + `,hop="2",node="202.97.1.1",asn="AS4134"} 0.015` + "\n",
+		`backtrace_hop_loss_ratio{` + labels + `,hop="2"} 0` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `key="AS4809a"`) {
+		t.Error("metrics of previous run still exported")
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	var b strings.Builder
+	c := New()
+	r := result()
+	r.Name = "a\"b\\c\nd"
+	c.Observe([]*backtrace.TargetResult{r}, 0)
+	if _, err := c.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `target="a\"b\\c\nd"`) {
+		t.Errorf("label not escaped:\n%s", b.String())
+	}
+}
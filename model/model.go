@@ -1,6 +1,10 @@
 package model
 
-import "time"
+import (
+	_ "embed"
+	"encoding/json"
+	"time"
+)
 
 const BackTraceVersion = "v0.0.9"
 
@@ -14,52 +18,52 @@ type IcmpTarget struct {
 	IPs       string `json:"ips"` // IP列表，以逗号分隔
 }
 
+// Target 回程路由检测目标
+type Target struct {
+	Name        string   `json:"name" yaml:"name"`
+	IP          string   `json:"ip" yaml:"ip"`
+	ISP         string   `json:"isp" yaml:"isp"`           // 电信、联通、移动
+	Province    string   `json:"province" yaml:"province"` // 用于匹配备选地址，与 IcmpTarget.Province 一致
+	City        string   `json:"city" yaml:"city"`
+	IPVersion   string   `json:"ip_version" yaml:"ip_version"`                         // v4 或 v6
+	FallbackIPs []string `json:"fallback_ips,omitempty" yaml:"fallback_ips,omitempty"` // 主地址不可达时依次尝试的备选地址
+}
+
+//go:embed targets.json
+var defaultTargetsData []byte
+
+// DefaultTargets 返回内置的检测目标列表，每次调用返回新的副本
+func DefaultTargets() []Target {
+	var targets []Target
+	_ = json.Unmarshal(defaultTargetsData, &targets)
+	return targets
+}
+
+// 以下变量仅为兼容旧版本的调用方保留
 var (
+	// IcmpTargets ICMP目标数据的地址
+	//
+	// Deprecated: 使用 icmpdata.DefaultSource 及 icmpdata.Loader
 	IcmpTargets = "https://raw.githubusercontent.com/spiritLHLS/icmp_targets/main/nodes.json"
-	CdnList     = []string{
-		"https://cdn.spiritlhl.net/",
-		"http://cdn1.spiritlhl.net/",
-		"http://cdn2.spiritlhl.net/",
-		"http://cdn3.spiritlhl.net/",
-		"http://cdn4.spiritlhl.net/",
-	}
-	Ipv4s = []string{
-		"219.141.140.10",  // 北京电信v4
-		"202.106.195.68",  // 北京联通v4
-		"221.179.155.161", // 北京移动v4
-		"202.96.209.133",  // 上海电信v4
-		"210.22.97.1",     // 上海联通v4
-		"211.136.112.200", // 上海移动v4
-		"58.60.188.222",   // 广州电信v4
-		"210.21.196.6",    // 广州联通v4
-		"120.196.165.24",  // 广州移动v4
-		"61.139.2.69",     // 成都电信v4
-		"119.6.6.6",       // 成都联通v4
-		"211.137.96.205",  // 成都移动v4
-	}
-
-	Ipv4Names = []string{
-		"北京电信v4", "北京联通v4", "北京移动v4",
-		"上海电信v4", "上海联通v4", "上海移动v4",
-		"广州电信v4", "广州联通v4", "广州移动v4",
-		"成都电信v4", "成都联通v4", "成都移动v4",
-	}
-	Ipv6s = []string{
-		"2400:89c0:1053:3::69",    // 北京电信 IPv6
-		"2400:89c0:1013:3::54",    // 北京联通 IPv6
-		"2409:8c00:8421:1303::55", // 北京移动 IPv6
-		"240e:e1:aa00:4000::24",   // 上海电信 IPV6
-		"2408:80f1:21:5003::a",    // 上海联通 IPv6
-		"2409:8c1e:75b0:3003::26", // 上海移动 IPv6
-		"240e:97c:2f:3000::44",    // 广州电信 IPv6
-		"2408:8756:f50:1001::c",   // 广州联通 IPv6
-		"2409:8c54:871:1001::12",  // 广州移动 IPv6
-	}
-	Ipv6Names = []string{
-		"北京电信v6", "北京联通v6", "北京移动v6",
-		"上海电信v6", "上海联通v6", "上海移动v6",
-		"广州电信v6", "广州联通v6", "广州移动v6",
-	}
+	// Ipv4s 内置的IPv4检测目标地址，与 Ipv4Names 一一对应
+	//
+	// Deprecated: 使用 DefaultTargets
+	Ipv4s []string
+	// Ipv4Names 内置的IPv4检测目标名称
+	//
+	// Deprecated: 使用 DefaultTargets
+	Ipv4Names []string
+	// Ipv6s 内置的IPv6检测目标地址，与 Ipv6Names 一一对应
+	//
+	// Deprecated: 使用 DefaultTargets
+	Ipv6s []string
+	// Ipv6Names 内置的IPv6检测目标名称
+	//
+	// Deprecated: 使用 DefaultTargets
+	Ipv6Names []string
+	// M ASN到线路说明的映射
+	//
+	// Deprecated: 线路识别规则由 rules 包的规则集给出
 	M = map[string]string{
 		// [] 前的字符串个数，中文占2个字符串
 		"AS23764": "电信CTGNET [精品线路]",
@@ -73,9 +77,41 @@ var (
 		"AS9808":  "移动CMI    [普通线路]",
 		"AS58453": "移动CMI    [普通线路]",
 	}
-	CachedIcmpData          string
+	// CachedIcmpData 最近一次检测加载的ICMP目标数据（JSON）
+	//
+	// Deprecated: 使用 icmpdata.Loader
+	CachedIcmpData string
+	// CachedIcmpDataFetchTime 最近一次加载ICMP目标数据的时间
+	//
+	// Deprecated: 使用 icmpdata.Loader
 	CachedIcmpDataFetchTime time.Time
-	ParsedIcmpTargets       []IcmpTarget
+	// ParsedIcmpTargets 最近一次检测加载的ICMP目标
+	//
+	// Deprecated: 使用 icmpdata.Loader
+	ParsedIcmpTargets []IcmpTarget
+)
+
+func init() {
+	for _, t := range DefaultTargets() {
+		if t.IPVersion == "v6" {
+			Ipv6s = append(Ipv6s, t.IP)
+			Ipv6Names = append(Ipv6Names, t.Name)
+		} else {
+			Ipv4s = append(Ipv4s, t.IP)
+			Ipv4Names = append(Ipv4Names, t.Name)
+		}
+	}
+}
+
+var (
+	// CdnList 获取ICMP目标数据时依次尝试的CDN镜像前缀
+	CdnList = []string{
+		"https://cdn.spiritlhl.net/",
+		"http://cdn1.spiritlhl.net/",
+		"http://cdn2.spiritlhl.net/",
+		"http://cdn3.spiritlhl.net/",
+		"http://cdn4.spiritlhl.net/",
+	}
 )
 
 var Tier1Global = map[string]string{
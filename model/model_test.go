@@ -0,0 +1,18 @@
+package model
+
+import "testing"
+
+func TestDeprecatedTargets(t *testing.T) {
+	if len(Ipv4s) != 12 || len(Ipv4Names) != len(Ipv4s) {
+		t.Fatalf("Ipv4s=%d Ipv4Names=%d", len(Ipv4s), len(Ipv4Names))
+	}
+	if len(Ipv6s) != 9 || len(Ipv6Names) != len(Ipv6s) {
+		t.Fatalf("Ipv6s=%d Ipv6Names=%d", len(Ipv6s), len(Ipv6Names))
+	}
+	if Ipv4s[0] != "219.141.140.10" || Ipv4Names[0] != "北京电信v4" {
+		t.Errorf("first IPv4 target %s %s", Ipv4Names[0], Ipv4s[0])
+	}
+	if Ipv6s[8] != "2409:8c54:871:1001::12" || Ipv6Names[8] != "广州移动v6" {
+		t.Errorf("last IPv6 target %s %s", Ipv6Names[8], Ipv6s[8])
+	}
+}
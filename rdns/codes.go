@@ -0,0 +1,207 @@
+package rdns
+
+type location struct {
+	city    string
+	country string
+}
+
+// siteCodes 路由器主机名中常见的三字母地点代码，大多为机场代码
+var siteCodes = map[string]location{
+	"lax": {"Los Angeles", "US"},
+	"sjc": {"San Jose", "US"},
+	"sfo": {"San Francisco", "US"},
+	"fmt": {"Fremont", "US"}, // HE
+	"pao": {"Palo Alto", "US"},
+	"sea": {"Seattle", "US"},
+	"pdx": {"Portland", "US"},
+	"den": {"Denver", "US"},
+	"phx": {"Phoenix", "US"},
+	"slc": {"Salt Lake City", "US"},
+	"dfw": {"Dallas", "US"},
+	"iah": {"Houston", "US"},
+	"ord": {"Chicago", "US"},
+	"chi": {"Chicago", "US"},
+	"atl": {"Atlanta", "US"},
+	"mia": {"Miami", "US"},
+	"iad": {"Ashburn", "US"},
+	"was": {"Washington", "US"},
+	"nyc": {"New York", "US"},
+	"jfk": {"New York", "US"},
+	"ewr": {"Newark", "US"},
+	"bos": {"Boston", "US"},
+	"yyz": {"Toronto", "CA"},
+	"tor": {"Toronto", "CA"},
+	"yvr": {"Vancouver", "CA"},
+	"yul": {"Montreal", "CA"},
+	"mex": {"Mexico City", "MX"},
+	"gru": {"Sao Paulo", "BR"},
+	"sao": {"Sao Paulo", "BR"},
+	"lhr": {"London", "GB"},
+	"lon": {"London", "GB"},
+	"ams": {"Amsterdam", "NL"},
+	"fra": {"Frankfurt", "DE"},
+	"cdg": {"Paris", "FR"},
+	"par": {"Paris", "FR"},
+	"mrs": {"Marseille", "FR"},
+	"mad": {"Madrid", "ES"},
+	"mil": {"Milan", "IT"},
+	"mxp": {"Milan", "IT"},
+	"zrh": {"Zurich", "CH"},
+	"vie": {"Vienna", "AT"},
+	"waw": {"Warsaw", "PL"},
+	"prg": {"Prague", "CZ"},
+	"sto": {"Stockholm", "SE"},
+	"arn": {"Stockholm", "SE"},
+	"cph": {"Copenhagen", "DK"},
+	"osl": {"Oslo", "NO"},
+	"hel": {"Helsinki", "FI"},
+	"dub": {"Dublin", "IE"},
+	"bru": {"Brussels", "BE"},
+	"mow": {"Moscow", "RU"},
+	"ist": {"Istanbul", "TR"},
+	"dxb": {"Dubai", "AE"},
+	"bom": {"Mumbai", "IN"},
+	"maa": {"Chennai", "IN"},
+	"sin": {"Singapore", "SG"},
+	"kul": {"Kuala Lumpur", "MY"},
+	"bkk": {"Bangkok", "TH"},
+	"cgk": {"Jakarta", "ID"},
+	"jkt": {"Jakarta", "ID"},
+	"mnl": {"Manila", "PH"},
+	"hkg": {"Hong Kong", "HK"},
+	"tpe": {"Taipei", "TW"},
+	"nrt": {"Tokyo", "JP"},
+	"hnd": {"Tokyo", "JP"},
+	"tyo": {"Tokyo", "JP"},
+	"osa": {"Osaka", "JP"},
+	"kix": {"Osaka", "JP"},
+	"icn": {"Seoul", "KR"},
+	"sel": {"Seoul", "KR"},
+	"pek": {"Beijing", "CN"},
+	"bjs": {"Beijing", "CN"},
+	"pvg": {"Shanghai", "CN"},
+	"sha": {"Shanghai", "CN"},
+	"can": {"Guangzhou", "CN"},
+	"szx": {"Shenzhen", "CN"},
+	"syd": {"Sydney", "AU"},
+	"mel": {"Melbourne", "AU"},
+	"akl": {"Auckland", "NZ"},
+	"jnb": {"Johannesburg", "ZA"},
+}
+
+// clliCodes CLLI地点代码的前4个字母（后接2个字母的州或国家代码），NTT等运营商使用
+var clliCodes = map[string]location{
+	"lsan": {"Los Angeles", "US"},
+	"snjs": {"San Jose", "US"},
+	"plal": {"Palo Alto", "US"},
+	"sntc": {"Santa Clara", "US"},
+	"sttl": {"Seattle", "US"},
+	"dnvr": {"Denver", "US"},
+	"phnx": {"Phoenix", "US"},
+	"dlls": {"Dallas", "US"},
+	"hstn": {"Houston", "US"},
+	"chcg": {"Chicago", "US"},
+	"atln": {"Atlanta", "US"},
+	"miam": {"Miami", "US"},
+	"asbn": {"Ashburn", "US"},
+	"wash": {"Washington", "US"},
+	"nycm": {"New York", "US"},
+	"nwrk": {"Newark", "US"},
+	"bstn": {"Boston", "US"},
+	"toky": {"Tokyo", "JP"},
+	"osak": {"Osaka", "JP"},
+	"sngp": {"Singapore", "SG"},
+	"sydn": {"Sydney", "AU"},
+	"lond": {"London", "GB"},
+	"frnk": {"Frankfurt", "DE"},
+	"amst": {"Amsterdam", "NL"},
+	"pari": {"Paris", "FR"},
+	"mdrd": {"Madrid", "ES"},
+	"mlan": {"Milan", "IT"},
+	"stck": {"Stockholm", "SE"},
+	"vien": {"Vienna", "AT"},
+}
+
+// cityNames 以城市全名作为地点的主机名，如 ear1.losangeles1.level3.net
+var cityNames = map[string]location{
+	"losangeles": {"Los Angeles", "US"},
+	"sanjose":    {"San Jose", "US"},
+	"seattle":    {"Seattle", "US"},
+	"chicago":    {"Chicago", "US"},
+	"dallas":     {"Dallas", "US"},
+	"miami":      {"Miami", "US"},
+	"ashburn":    {"Ashburn", "US"},
+	"washington": {"Washington", "US"},
+	"newyork":    {"New York", "US"},
+	"london":     {"London", "GB"},
+	"frankfurt":  {"Frankfurt", "DE"},
+	"amsterdam":  {"Amsterdam", "NL"},
+	"paris":      {"Paris", "FR"},
+	"tokyo":      {"Tokyo", "JP"},
+	"osaka":      {"Osaka", "JP"},
+	"singapore":  {"Singapore", "SG"},
+	"hongkong":   {"Hong Kong", "HK"},
+	"sydney":     {"Sydney", "AU"},
+}
+
+// cnProvinces 中国电信 163data 主机名中的省份代码
+var cnProvinces = map[string]string{
+	"bj": "Beijing",
+	"tj": "Tianjin",
+	"he": "Hebei",
+	"sx": "Shanxi",
+	"nm": "Inner Mongolia",
+	"ln": "Liaoning",
+	"jl": "Jilin",
+	"hl": "Heilongjiang",
+	"sh": "Shanghai",
+	"js": "Jiangsu",
+	"zj": "Zhejiang",
+	"ah": "Anhui",
+	"fj": "Fujian",
+	"jx": "Jiangxi",
+	"sd": "Shandong",
+	"ha": "Henan",
+	"hb": "Hubei",
+	"hn": "Hunan",
+	"gd": "Guangdong",
+	"gx": "Guangxi",
+	"hi": "Hainan",
+	"cq": "Chongqing",
+	"sc": "Sichuan",
+	"gz": "Guizhou",
+	"yn": "Yunnan",
+	"sn": "Shaanxi",
+	"gs": "Gansu",
+	"qh": "Qinghai",
+	"nx": "Ningxia",
+	"xj": "Xinjiang",
+}
+
+// cnCities 中国电信 163data 主机名中的 城市.省份 代码
+var cnCities = map[string]string{
+	"gz.gd": "Guangzhou",
+	"sz.gd": "Shenzhen",
+	"fs.gd": "Foshan",
+	"dg.gd": "Dongguan",
+	"hz.gd": "Huizhou",
+	"zh.gd": "Zhuhai",
+	"st.gd": "Shantou",
+	"hz.zj": "Hangzhou",
+	"nb.zj": "Ningbo",
+	"wz.zj": "Wenzhou",
+	"nj.js": "Nanjing",
+	"sz.js": "Suzhou",
+	"wx.js": "Wuxi",
+	"fz.fj": "Fuzhou",
+	"xm.fj": "Xiamen",
+	"wh.hb": "Wuhan",
+	"cs.hn": "Changsha",
+	"cd.sc": "Chengdu",
+	"nn.gx": "Nanning",
+	"km.yn": "Kunming",
+	"xa.sn": "Xi'an",
+	"hf.ah": "Hefei",
+	"jn.sd": "Jinan",
+	"qd.sd": "Qingdao",
+}
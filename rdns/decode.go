@@ -0,0 +1,181 @@
+package rdns
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Hint 从路由器主机名中提取的信息，各字段均可能为空
+type Hint struct {
+	Carrier   string `json:"carrier,omitempty"`   // 匹配的命名规则，如 NTT、Cogent
+	Code      string `json:"code,omitempty"`      // 主机名中的地点代码，如 lax、tokyjp
+	City      string `json:"city,omitempty"`      // 地点代码对应的城市
+	Country   string `json:"country,omitempty"`   // ISO 3166-1 二字母国家代码
+	Router    string `json:"router,omitempty"`    // 路由器名，如 ccr42、core1
+	Interface string `json:"interface,omitempty"` // 接口名，如 be3360、100ge14-1
+}
+
+// Location 返回用于展示的位置，城市未知时返回大写的地点代码
+func (h *Hint) Location() string {
+	if h == nil {
+		return ""
+	}
+	switch {
+	case h.City != "" && h.Country != "":
+		return h.City + ", " + h.Country
+	case h.City != "":
+		return h.City
+	}
+	return strings.ToUpper(h.Code)
+}
+
+// scheme 运营商的路由器命名规则，decode 的参数为去掉域名后缀后的标签
+type scheme struct {
+	carrier string
+	suffix  string
+	decode  func(labels []string, h *Hint)
+}
+
+var schemes = []scheme{
+	// ae-5.r24.tokyjp05.jp.bb.gin.ntt.net
+	{"NTT", ".gin.ntt.net", decodeCLLI},
+	// be3360.ccr42.lax01.atlas.cogentco.com
+	{"Cogent", ".cogentco.com", decodeSite},
+	// 100ge14-1.core1.lax1.he.net
+	{"HE", ".he.net", decodeSite},
+	// 183.6.0.1.broad.gz.gd.dynamic.163data.com.cn
+	{"ChinaNet", ".163data.com.cn", decodeChinaNet},
+}
+
+var (
+	clliRE   = regexp.MustCompile(`^([a-z]{4})([a-z]{2})\d*$`)
+	siteRE   = regexp.MustCompile(`^([a-z]{3})\d*$`)
+	cityRE   = regexp.MustCompile(`^([a-z]+?)\d*$`)
+	ifaceRE  = regexp.MustCompile(`^(ae|be|xe|ge|te|et|hu|fo|po|gi|vl|vlan|irb|eth|bundle-ether|port-channel|\d+ge)-?\d`)
+	routerRE = regexp.MustCompile(`^(r|cr|ccr|rcr|mpd|core|br|bb|ar|er|ear|car|pe|gw|edge|rtr|mx|asr)-?\d+`)
+)
+
+// Decode 根据运营商的命名规则解析路由器主机名，无法识别任何信息时返回nil
+func Decode(host string) *Hint {
+	host = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(host), "."))
+	if host == "" {
+		return nil
+	}
+	h := &Hint{}
+	matched := false
+	for _, s := range schemes {
+		if prefix, ok := strings.CutSuffix(host, s.suffix); ok && prefix != "" {
+			h.Carrier = s.carrier
+			s.decode(strings.Split(prefix, "."), h)
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		// 未知的命名规则：去掉注册域名后按常见的 接口.路由器.地点 形式识别
+		labels := strings.Split(host, ".")
+		if len(labels) <= 2 {
+			return nil
+		}
+		decodeGeneric(labels[:len(labels)-2], h)
+	}
+	if *h == (Hint{}) {
+		return nil
+	}
+	return h
+}
+
+// decodeCLLI 识别 [接口.]路由器.CLLI地点 形式的主机名，如NTT的 tokyjp05
+func decodeCLLI(labels []string, h *Hint) {
+	for i, l := range labels {
+		m := clliRE.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		loc, ok := clliCodes[m[1]]
+		if !ok {
+			continue
+		}
+		h.Code, h.City, h.Country = m[1]+m[2], loc.city, loc.country
+		splitDevice(labels[:i], h)
+		return
+	}
+}
+
+// decodeSite 识别 [接口.]路由器[.电路].地点 形式的主机名，地点为三字母代码加序号，如 lax01
+func decodeSite(labels []string, h *Hint) {
+	for i := len(labels) - 1; i >= 0; i-- {
+		m := siteRE.FindStringSubmatch(labels[i])
+		if m == nil {
+			continue
+		}
+		h.Code = m[1]
+		if loc, ok := siteCodes[m[1]]; ok {
+			h.City, h.Country = loc.city, loc.country
+		}
+		splitDevice(labels[:i], h)
+		return
+	}
+}
+
+// splitDevice 地点之前的标签依次为接口和路由器，只有一个标签时视为路由器
+func splitDevice(labels []string, h *Hint) {
+	switch len(labels) {
+	case 0:
+	case 1:
+		h.Router = labels[0]
+	default:
+		h.Interface, h.Router = labels[0], labels[1]
+	}
+}
+
+// decodeChinaNet 识别中国电信 163data 的 地址.类型.城市.省份.用途 形式
+func decodeChinaNet(labels []string, h *Hint) {
+	for i := len(labels) - 1; i > 0; i-- {
+		province, ok := cnProvinces[labels[i]]
+		if !ok {
+			continue
+		}
+		h.Country = "CN"
+		h.Code = labels[i-1] + "." + labels[i]
+		h.City = province
+		if city, ok := cnCities[h.Code]; ok {
+			h.City = city
+		}
+		return
+	}
+}
+
+// decodeGeneric 在标签中查找接口、路由器及地点，地点可为CLLI代码、三字母代码或城市全名
+func decodeGeneric(labels []string, h *Hint) {
+	rest := labels
+	if len(rest) > 1 && ifaceRE.MatchString(rest[0]) {
+		h.Interface = rest[0]
+		rest = rest[1:]
+	}
+	if len(rest) > 1 && routerRE.MatchString(rest[0]) {
+		h.Router = rest[0]
+		rest = rest[1:]
+	}
+	for _, l := range rest {
+		site, _, _ := strings.Cut(l, "-")
+		if m := clliRE.FindStringSubmatch(site); m != nil {
+			if loc, ok := clliCodes[m[1]]; ok {
+				h.Code, h.City, h.Country = m[1]+m[2], loc.city, loc.country
+				return
+			}
+		}
+		if m := siteRE.FindStringSubmatch(site); m != nil {
+			if loc, ok := siteCodes[m[1]]; ok {
+				h.Code, h.City, h.Country = m[1], loc.city, loc.country
+				return
+			}
+		}
+		if m := cityRE.FindStringSubmatch(site); m != nil {
+			if loc, ok := cityNames[m[1]]; ok {
+				h.Code, h.City, h.Country = m[1], loc.city, loc.country
+				return
+			}
+		}
+	}
+}
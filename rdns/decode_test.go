@@ -0,0 +1,40 @@
+package rdns
+
+import "testing"
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		host string
+		want Hint
+	}{
+		{"ae-5.r24.tokyjp05.jp.bb.gin.ntt.net.", Hint{Carrier: "NTT", Code: "tokyjp", City: "Tokyo", Country: "JP", Router: "r24", Interface: "ae-5"}},
+		{"r21.snjsca04.us.bb.gin.ntt.net", Hint{Carrier: "NTT", Code: "snjsca", City: "San Jose", Country: "US", Router: "r21"}},
+		{"be3360.ccr42.lax01.atlas.cogentco.com", Hint{Carrier: "Cogent", Code: "lax", City: "Los Angeles", Country: "US", Router: "ccr42", Interface: "be3360"}},
+		{"te0-0-2-0.rcr21.b001848-1.fra03.atlas.cogentco.com", Hint{Carrier: "Cogent", Code: "fra", City: "Frankfurt", Country: "DE", Router: "rcr21", Interface: "te0-0-2-0"}},
+		{"100ge14-1.core1.hkg1.he.net", Hint{Carrier: "HE", Code: "hkg", City: "Hong Kong", Country: "HK", Router: "core1", Interface: "100ge14-1"}},
+		{"core3.fmt2.he.net", Hint{Carrier: "HE", Code: "fmt", City: "Fremont", Country: "US", Router: "core3"}},
+		{"183.6.0.1.broad.gz.gd.dynamic.163data.com.cn", Hint{Carrier: "ChinaNet", Code: "gz.gd", City: "Guangzhou", Country: "CN"}},
+		{"1.2.3.4.broad.xx.sc.dynamic.163data.com.cn", Hint{Carrier: "ChinaNet", Code: "xx.sc", City: "Sichuan", Country: "CN"}},
+		{"ae-1-3502.ear1.losangeles1.level3.net", Hint{Code: "losangeles", City: "Los Angeles", Country: "US", Interface: "ae-1-3502", Router: "ear1"}},
+		{"xe-0-0-1.cr1.ams2.example.net", Hint{Code: "ams", City: "Amsterdam", Country: "NL", Router: "cr1", Interface: "xe-0-0-1"}},
+		// 未知的地点代码只保留路由器信息
+		{"be10.xyz1.qqq9.atlas.cogentco.com", Hint{Carrier: "Cogent", Code: "qqq", Router: "xyz1", Interface: "be10"}},
+	}
+	for _, tt := range tests {
+		got := Decode(tt.host)
+		if got == nil || *got != tt.want {
+			t.Errorf("Decode(%q) = %+v, want %+v", tt.host, got, tt.want)
+		}
+	}
+	for _, host := range []string{"", "example.com", "mail.example.com", "dns.google."} {
+		if got := Decode(host); got != nil {
+			t.Errorf("Decode(%q) = %+v, want nil", host, got)
+		}
+	}
+	if loc := Decode("be3360.ccr42.lax01.atlas.cogentco.com").Location(); loc != "Los Angeles, US" {
+		t.Errorf("Location() = %q", loc)
+	}
+	if loc := (&Hint{Code: "qqq"}).Location(); loc != "QQQ" {
+		t.Errorf("Location() = %q", loc)
+	}
+}
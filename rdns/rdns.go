@@ -0,0 +1,113 @@
+// Package rdns 反向解析路由节点的地址，并从运营商的路由器命名规则中提取位置及接口信息
+package rdns
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultConcurrency = 16              // 默认同时进行的查询数量
+	DefaultTimeout     = 2 * time.Second // 默认单次查询超时
+)
+
+// Resolver 并发受限的PTR解析器，可在多次检测间共用，结果（包括没有记录的地址）在其生命周期内缓存
+type Resolver struct {
+	Addr        string        // DNS服务器地址（host 或 host:port），为空时使用系统解析器
+	Concurrency int           // 同时进行的查询数量，为0时使用 DefaultConcurrency
+	Timeout     time.Duration // 单次查询超时，为0时使用 DefaultTimeout
+
+	once     sync.Once
+	resolver *net.Resolver
+	sem      chan struct{}
+	mu       sync.Mutex
+	cache    map[string]string
+}
+
+// init 根据配置创建底层解析器
+func (r *Resolver) init() {
+	r.once.Do(func() {
+		r.resolver = net.DefaultResolver
+		if r.Addr != "" {
+			addr := r.Addr
+			if _, _, err := net.SplitHostPort(addr); err != nil {
+				addr = net.JoinHostPort(strings.Trim(addr, "[]"), "53")
+			}
+			r.resolver = &net.Resolver{
+				PreferGo: true,
+				Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, network, addr)
+				},
+			}
+		}
+		n := r.Concurrency
+		if n <= 0 {
+			n = DefaultConcurrency
+		}
+		r.sem = make(chan struct{}, n)
+		r.cache = make(map[string]string)
+	})
+}
+
+// Lookup 返回 ip 的第一个PTR记录（不含末尾的点），没有记录或查询失败时返回空字符串
+func (r *Resolver) Lookup(ctx context.Context, ip string) string {
+	r.init()
+	r.mu.Lock()
+	name, ok := r.cache[ip]
+	r.mu.Unlock()
+	if ok {
+		return name
+	}
+	select {
+	case r.sem <- struct{}{}:
+		defer func() { <-r.sem }()
+	case <-ctx.Done():
+		return ""
+	}
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	lookupCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	names, err := r.resolver.LookupAddr(lookupCtx, ip)
+	if err == nil && len(names) > 0 {
+		name = strings.TrimSuffix(names[0], ".")
+	}
+	// 调用方取消时不缓存，以免把未完成的查询记为没有记录
+	if ctx.Err() == nil {
+		r.mu.Lock()
+		r.cache[ip] = name
+		r.mu.Unlock()
+	}
+	return name
+}
+
+// LookupAll 并发解析多个地址，返回有PTR记录的地址到主机名的映射
+func (r *Resolver) LookupAll(ctx context.Context, ips []string) map[string]string {
+	names := make(map[string]string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	seen := make(map[string]bool)
+	for _, ip := range ips {
+		if seen[ip] {
+			continue
+		}
+		seen[ip] = true
+		wg.Add(1)
+		go func(ip string) {
+			defer wg.Done()
+			if name := r.Lookup(ctx, ip); name != "" {
+				mu.Lock()
+				names[ip] = name
+				mu.Unlock()
+			}
+		}(ip)
+	}
+	wg.Wait()
+	return names
+}
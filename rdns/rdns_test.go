@@ -0,0 +1,68 @@
+package rdns
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// serveDNS 在本地UDP端口上应答PTR查询，返回服务器地址及收到的查询数量
+func serveDNS(t *testing.T, records map[string]string) (string, *atomic.Int32) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	var queries atomic.Int32
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var msg dnsmessage.Message
+			if err := msg.Unpack(buf[:n]); err != nil || len(msg.Questions) == 0 {
+				continue
+			}
+			queries.Add(1)
+			q := msg.Questions[0]
+			msg.Header.Response = true
+			msg.Header.RCode = dnsmessage.RCodeNameError
+			if name, ok := records[q.Name.String()]; ok && q.Type == dnsmessage.TypePTR {
+				msg.Header.RCode = dnsmessage.RCodeSuccess
+				msg.Answers = []dnsmessage.Resource{{
+					Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET, TTL: 60},
+					Body:   &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(name)},
+				}}
+			}
+			if out, err := msg.Pack(); err == nil {
+				conn.WriteTo(out, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String(), &queries
+}
+
+func TestResolver(t *testing.T) {
+	addr, queries := serveDNS(t, map[string]string{
+		"1.2.0.192.in-addr.arpa.": "be3360.ccr42.lax01.atlas.cogentco.com.",
+		"2.2.0.192.in-addr.arpa.": "100ge14-1.core1.hkg1.he.net.",
+	})
+	r := &Resolver{Addr: addr, Concurrency: 2}
+	ctx := context.Background()
+	names := r.LookupAll(ctx, []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.1"})
+	if len(names) != 2 || names["192.0.2.1"] != "be3360.ccr42.lax01.atlas.cogentco.com" || names["192.0.2.2"] != "100ge14-1.core1.hkg1.he.net" {
+		t.Fatalf("LookupAll = %v", names)
+	}
+	// 结果（包括没有记录的地址）被缓存
+	before := queries.Load()
+	r.LookupAll(ctx, []string{"192.0.2.1", "192.0.2.3"})
+	if after := queries.Load(); after != before {
+		t.Errorf("%d queries sent for cached addresses", after-before)
+	}
+}
@@ -0,0 +1,143 @@
+package rules
+
+import (
+	"net/netip"
+	"sort"
+)
+
+// Hop 回程路径上的一个节点，按距离顺序排列
+type Hop struct {
+	Distance int
+	IP       netip.Addr
+	ASN      string // 节点所属ASN，未知时为空
+}
+
+// Classify 按规则识别路径经过的线路，返回命中的规则：
+// 被其他命中规则替代的规则和描述重复的规则会被去除，结果按首次出现的位置和规则顺序排序
+func (rs *RuleSet) Classify(path []Hop) []*Rule {
+	type match struct {
+		rule *Rule
+		pos  int
+	}
+	var matches []match
+	replaced := make(map[string]bool)
+	for _, r := range rs.Rules {
+		if pos, ok := r.match(path); ok {
+			matches = append(matches, match{r, pos})
+			for _, key := range r.Replaces {
+				replaced[key] = true
+			}
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].pos < matches[j].pos
+	})
+	var result []*Rule
+	seen := make(map[string]bool)
+	for _, m := range matches {
+		if replaced[m.rule.Key] || seen[m.rule.Description] {
+			continue
+		}
+		seen[m.rule.Description] = true
+		result = append(result, m.rule)
+	}
+	return result
+}
+
+// Combines 返回规则是否由 asn 的线路与其他线路组合而成，即 asn 不是规则所属ASN，
+// 但出现在 all 或 order 条件中，如CN2GT组合了163
+func (r *Rule) Combines(asn string) bool {
+	return asn != "" && asn != r.ASN && (contains(r.All, asn) || contains(r.Order, asn))
+}
+
+// Label 返回单个节点ASN对应的线路简称：优先使用键等于该ASN的规则，其次使用所属ASN相同的第一条规则
+func (rs *RuleSet) Label(asn string) string {
+	if asn == "" {
+		return ""
+	}
+	for _, r := range rs.Rules {
+		if r.Key == asn {
+			return r.Name
+		}
+	}
+	for _, r := range rs.Rules {
+		if r.ASN == asn {
+			return r.Name
+		}
+	}
+	return ""
+}
+
+// match 判断路径是否满足规则，返回命中条件的节点首次出现的位置
+func (r *Rule) match(path []Hop) (int, bool) {
+	present := make(map[string]bool)
+	pos := len(path)
+	prefixHit := false
+	next := 0 // order 中下一个待匹配的ASN
+	for i, h := range path {
+		if (r.MinHop > 0 && h.Distance < r.MinHop) || (r.MaxHop > 0 && h.Distance > r.MaxHop) {
+			continue
+		}
+		if h.ASN != "" {
+			present[h.ASN] = true
+			if next < len(r.Order) && h.ASN == r.Order[next] {
+				next++
+			}
+			if i < pos && (contains(r.All, h.ASN) || contains(r.Any, h.ASN) || contains(r.Order, h.ASN)) {
+				pos = i
+			}
+		}
+		if h.IP.IsValid() && r.inPrefixes(h.IP) {
+			prefixHit = true
+			if i < pos {
+				pos = i
+			}
+		}
+	}
+	for _, asn := range r.All {
+		if !present[asn] {
+			return 0, false
+		}
+	}
+	if len(r.Any) > 0 && !containsAny(present, r.Any) {
+		return 0, false
+	}
+	if containsAny(present, r.None) {
+		return 0, false
+	}
+	if next < len(r.Order) {
+		return 0, false
+	}
+	if len(r.prefixes) > 0 && !prefixHit {
+		return 0, false
+	}
+	return pos, true
+}
+
+func (r *Rule) inPrefixes(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range r.prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, it := range list {
+		if it == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(set map[string]bool, list []string) bool {
+	for _, it := range list {
+		if set[it] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+// Package rules 以声明式规则文件描述线路识别逻辑：ASN集合、出现顺序、跳数范围和前缀匹配映射到线路及其等级，
+// 新的线路类型只需修改规则文件，无需重新编译
+package rules
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 线路等级
+const (
+	TierPremium = "premium" // 精品线路
+	TierGood    = "good"    // 优质线路
+	TierNormal  = "normal"  // 普通线路
+)
+
+//go:embed default.yaml
+var defaultRules []byte
+
+// Rule 一条线路识别规则，各条件之间为“且”的关系，未设置的条件不参与判断
+type Rule struct {
+	Key         string   `json:"key" yaml:"key"`
+	Name        string   `json:"name" yaml:"name"`
+	ASN         string   `json:"asn" yaml:"asn"`
+	Description string   `json:"description" yaml:"description"`
+	Tier        string   `json:"tier" yaml:"tier"`
+	All         []string `json:"all,omitempty" yaml:"all,omitempty"`
+	Any         []string `json:"any,omitempty" yaml:"any,omitempty"`
+	None        []string `json:"none,omitempty" yaml:"none,omitempty"`
+	Order       []string `json:"order,omitempty" yaml:"order,omitempty"`
+	Prefixes    []string `json:"prefixes,omitempty" yaml:"prefixes,omitempty"`
+	MinHop      int      `json:"min_hop,omitempty" yaml:"min_hop,omitempty"`
+	MaxHop      int      `json:"max_hop,omitempty" yaml:"max_hop,omitempty"`
+	Replaces    []string `json:"replaces,omitempty" yaml:"replaces,omitempty"`
+
+	prefixes []netip.Prefix
+}
+
+// RuleSet 按顺序排列的规则集合，加载完成后可并发使用
+type RuleSet struct {
+	Rules []*Rule `json:"rules" yaml:"rules"`
+}
+
+var defaultSet = mustParse(defaultRules, "yaml")
+
+// Default 返回内置的规则集合
+func Default() *RuleSet {
+	return defaultSet
+}
+
+func mustParse(data []byte, format string) *RuleSet {
+	rs, err := Parse(data, format)
+	if err != nil {
+		panic("rules: invalid default rules: " + err.Error())
+	}
+	return rs
+}
+
+// Load 从 JSON 或 YAML 文件加载规则，扩展名为 .json 时按 JSON 解析，否则按 YAML 解析
+func Load(path string) (*RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取规则文件失败: %w", err)
+	}
+	format := "yaml"
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		format = "json"
+	}
+	return Parse(data, format)
+}
+
+// Parse 解析 format 格式（json 或 yaml）的规则文件并校验每条规则
+func Parse(data []byte, format string) (*RuleSet, error) {
+	rs := &RuleSet{}
+	var err error
+	switch format {
+	case "json":
+		err = json.Unmarshal(data, rs)
+	case "yaml":
+		err = yaml.Unmarshal(data, rs)
+	default:
+		return nil, fmt.Errorf("unsupported rules format: %s", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析规则失败: %w", err)
+	}
+	if len(rs.Rules) == 0 {
+		return nil, fmt.Errorf("规则列表为空")
+	}
+	keys := make(map[string]bool)
+	for i, r := range rs.Rules {
+		if r == nil {
+			return nil, fmt.Errorf("第%d条规则为空", i+1)
+		}
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("第%d条规则 %s 无效: %w", i+1, r.Key, err)
+		}
+		keys[r.Key] = true
+	}
+	for _, r := range rs.Rules {
+		for _, key := range r.Replaces {
+			if !keys[key] {
+				return nil, fmt.Errorf("规则 %s 替代了不存在的规则 %s", r.Key, key)
+			}
+		}
+	}
+	return rs, nil
+}
+
+// compile 校验规则，统一ASN写法并解析前缀
+func (r *Rule) compile() error {
+	if r.Key == "" {
+		return fmt.Errorf("missing key")
+	}
+	if r.Description == "" {
+		return fmt.Errorf("missing description")
+	}
+	switch r.Tier {
+	case "":
+		r.Tier = TierNormal
+	case TierPremium, TierGood, TierNormal:
+	default:
+		return fmt.Errorf("unknown tier %q", r.Tier)
+	}
+	if r.MinHop < 0 || r.MaxHop < 0 || (r.MaxHop > 0 && r.MaxHop < r.MinHop) {
+		return fmt.Errorf("invalid hop range %d-%d", r.MinHop, r.MaxHop)
+	}
+	if r.Name == "" {
+		r.Name = r.Key
+	}
+	r.ASN = normalizeASN(r.ASN)
+	for _, list := range [][]string{r.All, r.Any, r.None, r.Order} {
+		for i, asn := range list {
+			if list[i] = normalizeASN(asn); list[i] == "" {
+				return fmt.Errorf("empty ASN in condition")
+			}
+		}
+	}
+	r.prefixes = r.prefixes[:0]
+	for _, s := range r.Prefixes {
+		p, err := netip.ParsePrefix(strings.TrimSpace(s))
+		if err != nil {
+			return err
+		}
+		r.prefixes = append(r.prefixes, p.Masked())
+	}
+	if len(r.All)+len(r.Any)+len(r.Order)+len(r.prefixes) == 0 {
+		return fmt.Errorf("rule has no positive condition")
+	}
+	return nil
+}
+
+// normalizeASN 将 4809、as4809 等写法统一为 AS4809
+func normalizeASN(asn string) string {
+	asn = strings.TrimSpace(asn)
+	if asn == "" {
+		return ""
+	}
+	return "AS" + strings.TrimPrefix(strings.ToUpper(asn), "AS")
+}
@@ -0,0 +1,121 @@
+package rules
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func names(rs []*Rule) string {
+	var parts []string
+	for _, r := range rs {
+		parts = append(parts, r.Name)
+	}
+	return strings.Join(parts, ",")
+}
+
+func path(hops ...string) []Hop {
+	var p []Hop
+	for i, h := range hops {
+		asn, ip, _ := strings.Cut(h, "@")
+		hop := Hop{Distance: i + 1, ASN: asn}
+		if ip != "" {
+			hop.IP = netip.MustParseAddr(ip)
+		}
+		p = append(p, hop)
+	}
+	return p
+}
+
+func TestDefault(t *testing.T) {
+	cases := []struct {
+		path []Hop
+		want string
+	}{
+		{path("AS4809"), "CN2GIA"},
+		{path("AS4134", "AS4809"), "CN2GT,163"},
+		{path("AS4134", "AS4809", "AS4134"), "CN2GT,163"},
+		{path("AS4809", "AS4134"), "CN2,163"},
+		{path("AS4837", "AS9929"), "4837,9929"},
+		{path("AS9808", "AS58453"), "CMI"},
+		{path("", "AS23764"), "CTGNET"},
+		{path("AS64500"), ""},
+	}
+	for _, c := range cases {
+		if got := names(Default().Classify(c.path)); got != c.want {
+			t.Errorf("Classify(%v) = %q, want %q", c.path, got, c.want)
+		}
+	}
+	if got := Default().Label("AS4809"); got != "CN2" {
+		t.Errorf("Label(AS4809) = %q, want CN2", got)
+	}
+}
+
+func TestConditions(t *testing.T) {
+	rs, err := Parse([]byte(`
+rules:
+  - key: cn2-core
+    name: CN2-CORE
+    description: "CN2 core"
+    tier: premium
+    prefixes: [59.43.0.0/18]
+    min_hop: 3
+  - key: cn2-edge
+    name: CN2-EDGE
+    description: "CN2 edge"
+    tier: good
+    any: [4809]
+    replaces: [cn2-core]
+    order: [AS4134, as4809]
+`), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.Rules[1].Any[0] != "AS4809" || rs.Rules[1].Order[1] != "AS4809" {
+		t.Errorf("ASNs not normalized: %v %v", rs.Rules[1].Any, rs.Rules[1].Order)
+	}
+	cases := []struct {
+		path []Hop
+		want string
+	}{
+		// 核心地址段出现在第3跳以后
+		{path("", "", "AS4809@59.43.1.1"), "CN2-CORE"},
+		// 跳数范围之外的节点不参与判断
+		{path("", "AS4809@59.43.1.1"), ""},
+		// 地址不在前缀内
+		{path("", "", "AS4809@59.43.200.1"), ""},
+		// 先经过163再进入CN2时由 cn2-edge 替代 cn2-core
+		{path("AS4134", "", "AS4809@59.43.1.1"), "CN2-EDGE"},
+		// 顺序不满足
+		{path("AS4809", "AS4134"), ""},
+	}
+	for _, c := range cases {
+		if got := names(rs.Classify(c.path)); got != c.want {
+			t.Errorf("Classify(%v) = %q, want %q", c.path, got, c.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []string{
+		`rules: []`,
+		`rules: [{key: a, description: x}]`,
+		`rules: [{key: a, description: x, any: [AS1], tier: gold}]`,
+		`rules: [{key: a, description: x, prefixes: [bad]}]`,
+		`rules: [{key: a, description: x, any: [AS1], replaces: [b]}]`,
+		`rules: [{description: x, any: [AS1]}]`,
+		`rules: [{key: a, description: x, any: [AS1], min_hop: 5, max_hop: 2}]`,
+	}
+	for _, c := range cases {
+		if _, err := Parse([]byte(c), "yaml"); err == nil {
+			t.Errorf("Parse(%s) succeeded", c)
+		}
+	}
+	rs, err := Parse([]byte(`{"rules":[{"key":"a","description":"x","any":["1"]}]}`), "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.Rules[0].Tier != TierNormal || rs.Rules[0].Name != "a" {
+		t.Errorf("defaults not applied: %+v", rs.Rules[0])
+	}
+}
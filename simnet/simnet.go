@@ -0,0 +1,262 @@
+// Package simnet 模拟由若干路由跳点组成的网络，实现 backtrace.Transport 接口，
+// 按探测包的TTL生成 ICMP Time Exceeded、Echo Reply、端口不可达及 TCP SYN-ACK 应答，
+// 支持逐跳配置时延、丢包以及按流哈希选择的等价多路径，用于离线、确定性地测试 Tracer
+package simnet
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// IANA 协议号
+const (
+	protocolICMP     = 1
+	protocolTCP      = 6
+	protocolUDP      = 17
+	protocolIPv6ICMP = 58
+)
+
+// Hop 路径上的一跳
+type Hop struct {
+	IP      net.IP        // 节点地址，为 nil 时该跳不响应
+	Latency time.Duration // 从探测发出到收到该跳应答的往返时延
+	Loss    float64       // 应答的丢失概率，取值 0~1
+}
+
+// message 待投递给 Tracer 的应答
+type message struct {
+	b     []byte
+	proto int
+	src   net.IP
+}
+
+// Network 模拟网络，可并发使用
+type Network struct {
+	mu     sync.Mutex
+	routes map[string][][]Hop // 目标地址 -> 等价路径
+	rand   *rand.Rand
+
+	in        chan message
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New 返回空的模拟网络，seed 决定丢包的随机序列
+func New(seed int64) *Network {
+	return &Network{
+		routes: make(map[string][][]Hop),
+		rand:   rand.New(rand.NewSource(seed)),
+		in:     make(chan message, 256),
+		done:   make(chan struct{}),
+	}
+}
+
+// AddRoute 添加一条到 dst 的路径，hops 依次为第1跳、第2跳……
+// 路径最后一跳的地址等于 dst 时，TTL 不小于其距离的探测由目标应答；否则目标不可达，后续探测无应答。
+// 对同一目标多次调用时添加的是等价路径，探测包按流标识的哈希选择其中一条
+func (n *Network) AddRoute(dst net.IP, hops ...Hop) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	key := string(canonical(dst))
+	n.routes[key] = append(n.routes[key], hops)
+}
+
+// WriteTo 模拟发送探测包，应答在对应跳点的时延后可由 ReadFrom 读取
+func (n *Network) WriteTo(b []byte, proto, hopLimit int, dst net.IP) error {
+	select {
+	case <-n.done:
+		return net.ErrClosed
+	default:
+	}
+	var (
+		header  []byte // 引用在差错报文中的原始IP头部
+		payload []byte
+		ttl     int
+		v4      = dst.To4() != nil
+	)
+	if v4 {
+		h, err := ipv4.ParseHeader(b)
+		if err != nil {
+			return err
+		}
+		if h.Len > len(b) {
+			return errors.New("simnet: truncated IPv4 packet")
+		}
+		header, payload, ttl, proto = append([]byte(nil), b[:h.Len]...), b[h.Len:], h.TTL, h.Protocol
+	} else {
+		header, payload, ttl = newIPv6Header(dst, proto, len(b)), b, hopLimit
+	}
+	if ttl < 1 {
+		return nil
+	}
+	n.mu.Lock()
+	paths := n.routes[string(canonical(dst))]
+	if len(paths) == 0 {
+		n.mu.Unlock()
+		return nil
+	}
+	path := paths[flowHash(proto, payload)%uint32(len(paths))]
+	dist := ttl
+	if dist > len(path) {
+		dist = len(path)
+	}
+	hop := path[dist-1]
+	lost := hop.IP == nil || (hop.Loss > 0 && n.rand.Float64() < hop.Loss)
+	n.mu.Unlock()
+	if lost {
+		return nil
+	}
+	atDst := hop.IP.Equal(dst)
+	if !atDst && ttl > len(path) {
+		// 目标不在路径上，超出路径长度的探测无应答
+		return nil
+	}
+	// 节点收到探测包时剩余的TTL
+	setTTL(header, v4, ttl-dist+1)
+	var reply message
+	var err error
+	if atDst {
+		reply, err = destinationReply(hop.IP, v4, proto, header, payload)
+	} else {
+		reply, err = timeExceeded(hop.IP, v4, header, payload)
+	}
+	if err != nil || reply.b == nil {
+		return err
+	}
+	time.AfterFunc(hop.Latency, func() {
+		select {
+		case n.in <- reply:
+		case <-n.done:
+		}
+	})
+	return nil
+}
+
+// ReadFrom 读取下一条应答
+func (n *Network) ReadFrom(b []byte) (int, int, net.IP, error) {
+	select {
+	case msg := <-n.in:
+		return copy(b, msg.b), msg.proto, msg.src, nil
+	case <-n.done:
+		return 0, 0, nil, net.ErrClosed
+	}
+}
+
+// Close 关闭模拟网络，阻塞中的 ReadFrom 返回 net.ErrClosed
+func (n *Network) Close() error {
+	n.closeOnce.Do(func() { close(n.done) })
+	return nil
+}
+
+// timeExceeded 构造中间节点返回的 Time Exceeded 报文，IPv4 按 RFC 792 只引用上层报文的前8个字节
+func timeExceeded(from net.IP, v4 bool, header, payload []byte) (message, error) {
+	if v4 {
+		if len(payload) > 8 {
+			payload = payload[:8]
+		}
+		b, err := marshal(ipv4.ICMPTypeTimeExceeded, 0, &icmp.TimeExceeded{Data: concat(header, payload)})
+		return message{b, protocolICMP, from}, err
+	}
+	b, err := marshal(ipv6.ICMPTypeTimeExceeded, 0, &icmp.TimeExceeded{Data: concat(header, payload)})
+	return message{b, protocolIPv6ICMP, from}, err
+}
+
+// destinationReply 构造目标对探测包的应答：ICMP Echo Reply、UDP 端口不可达或 TCP SYN-ACK
+func destinationReply(from net.IP, v4 bool, proto int, header, payload []byte) (message, error) {
+	switch proto {
+	case protocolICMP, protocolIPv6ICMP:
+		msg, err := icmp.ParseMessage(proto, payload)
+		if err != nil {
+			return message{}, err
+		}
+		echo, ok := msg.Body.(*icmp.Echo)
+		if !ok {
+			return message{}, nil
+		}
+		if v4 {
+			b, err := marshal(ipv4.ICMPTypeEchoReply, 0, echo)
+			return message{b, protocolICMP, from}, err
+		}
+		b, err := marshal(ipv6.ICMPTypeEchoReply, 0, echo)
+		return message{b, protocolIPv6ICMP, from}, err
+	case protocolUDP:
+		if v4 {
+			b, err := marshal(ipv4.ICMPTypeDestinationUnreachable, 3, &icmp.DstUnreach{Data: concat(header, payload)})
+			return message{b, protocolICMP, from}, err
+		}
+		b, err := marshal(ipv6.ICMPTypeDestinationUnreachable, 4, &icmp.DstUnreach{Data: concat(header, payload)})
+		return message{b, protocolIPv6ICMP, from}, err
+	case protocolTCP:
+		if len(payload) < 20 {
+			return message{}, errors.New("simnet: truncated TCP segment")
+		}
+		b := make([]byte, 20)
+		copy(b[0:2], payload[2:4])
+		copy(b[2:4], payload[0:2])
+		binary.BigEndian.PutUint32(b[8:12], binary.BigEndian.Uint32(payload[4:8])+1)
+		b[12] = 5 << 4
+		b[13] = 0x12 // SYN|ACK
+		return message{b, protocolTCP, from}, nil
+	}
+	return message{}, nil
+}
+
+// flowHash 按负载均衡设备的方式计算流哈希：UDP/TCP 使用端口，ICMP 使用类型、校验和与标识符
+func flowHash(proto int, payload []byte) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte{byte(proto)})
+	switch proto {
+	case protocolUDP, protocolTCP:
+		if len(payload) >= 4 {
+			h.Write(payload[:4])
+		}
+	case protocolICMP, protocolIPv6ICMP:
+		if len(payload) >= 6 {
+			h.Write(payload[:6])
+		}
+	}
+	return h.Sum32()
+}
+
+func marshal(typ icmp.Type, code int, body icmp.MessageBody) ([]byte, error) {
+	return (&icmp.Message{Type: typ, Code: code, Body: body}).Marshal(nil)
+}
+
+// newIPv6Header 构造引用在 ICMPv6 差错报文中的IPv6头部
+func newIPv6Header(dst net.IP, proto, length int) []byte {
+	b := make([]byte, ipv6.HeaderLen)
+	b[0] = ipv6.Version << 4
+	binary.BigEndian.PutUint16(b[4:6], uint16(length))
+	b[6] = byte(proto)
+	copy(b[24:40], dst.To16())
+	return b
+}
+
+// setTTL 修改引用头部中的 TTL/Hop Limit
+func setTTL(header []byte, v4 bool, ttl int) {
+	if v4 {
+		header[8] = byte(ttl)
+	} else {
+		header[7] = byte(ttl)
+	}
+}
+
+func concat(a, b []byte) []byte {
+	return append(append([]byte(nil), a...), b...)
+}
+
+func canonical(ip net.IP) net.IP {
+	if v := ip.To4(); v != nil {
+		return v
+	}
+	return ip.To16()
+}
@@ -0,0 +1,74 @@
+package simnet
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+func echoRequest(t *testing.T, dst net.IP, ttl int) []byte {
+	t.Helper()
+	p, err := (&icmp.Message{Type: ipv4.ICMPTypeEcho, Body: &icmp.Echo{ID: 7, Seq: 7}}).Marshal(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := (&ipv4.Header{
+		Version: ipv4.Version, Len: ipv4.HeaderLen, TotalLen: ipv4.HeaderLen + len(p),
+		TTL: ttl, Protocol: protocolICMP, Dst: dst,
+	}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(h, p...)
+}
+
+func TestNetwork(t *testing.T) {
+	dst := net.ParseIP("198.51.100.7").To4()
+	n := New(1)
+	defer n.Close()
+	n.AddRoute(dst,
+		Hop{IP: net.ParseIP("10.0.0.1")},
+		Hop{IP: net.ParseIP("10.0.0.2"), Latency: 10 * time.Millisecond},
+		Hop{IP: dst},
+	)
+	cases := []struct {
+		ttl  int
+		from string
+		typ  icmp.Type
+	}{
+		{1, "10.0.0.1", ipv4.ICMPTypeTimeExceeded},
+		{2, "10.0.0.2", ipv4.ICMPTypeTimeExceeded},
+		{3, "198.51.100.7", ipv4.ICMPTypeEchoReply},
+		{9, "198.51.100.7", ipv4.ICMPTypeEchoReply},
+	}
+	buf := make([]byte, 1500)
+	for _, c := range cases {
+		start := time.Now()
+		if err := n.WriteTo(echoRequest(t, dst, c.ttl), protocolICMP, 0, dst); err != nil {
+			t.Fatal(err)
+		}
+		size, proto, from, err := n.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.ttl == 2 && time.Since(start) < 10*time.Millisecond {
+			t.Errorf("ttl %d: reply arrived before the configured latency", c.ttl)
+		}
+		msg, err := icmp.ParseMessage(proto, buf[:size])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !from.Equal(net.ParseIP(c.from)) || msg.Type != c.typ {
+			t.Errorf("ttl %d: got %v from %v, want %v from %s", c.ttl, msg.Type, from, c.typ, c.from)
+		}
+	}
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := n.ReadFrom(buf); err != net.ErrClosed {
+		t.Errorf("ReadFrom after Close: %v", err)
+	}
+}
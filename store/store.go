@@ -0,0 +1,92 @@
+// Package store 将每次检测的结果追加保存到本地 JSON Lines 文件，每行一次检测，
+// 用于比较不同时间的检测结果、发现线路变化
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	backtrace "github.com/oneclickvirt/backtrace/bk"
+)
+
+// Run 一次保存的检测
+type Run struct {
+	ID      int                       `json:"id"` // 从1开始递增的编号
+	Time    time.Time                 `json:"time"`
+	Version string                    `json:"version"`
+	Results []*backtrace.TargetResult `json:"results"`
+}
+
+// Load 读取文件中保存的全部检测，按保存顺序排列，文件不存在时返回空列表
+func Load(path string) ([]*Run, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var runs []*Run
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		run := &Run{}
+		if err := json.Unmarshal(scanner.Bytes(), run); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		runs = append(runs, run)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// Append 为 run 分配编号并追加到文件末尾，文件不存在时创建
+func Append(path string, run *Run) error {
+	runs, err := Load(path)
+	if err != nil {
+		return err
+	}
+	run.ID = 1
+	if n := len(runs); n > 0 {
+		run.ID = runs[n-1].ID + 1
+	}
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Find 按编号查找检测，id 为负数时表示倒数第几次，如 -1 为最近一次
+func Find(runs []*Run, id int) (*Run, error) {
+	if id < 0 {
+		if -id > len(runs) {
+			return nil, fmt.Errorf("only %d runs stored", len(runs))
+		}
+		return runs[len(runs)+id], nil
+	}
+	for _, run := range runs {
+		if run.ID == id {
+			return run, nil
+		}
+	}
+	return nil, fmt.Errorf("run %d not found", id)
+}
@@ -0,0 +1,39 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	backtrace "github.com/oneclickvirt/backtrace/bk"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runs.jsonl")
+	if runs, err := Load(path); err != nil || len(runs) != 0 {
+		t.Fatalf("Load of missing file = %v, %v", runs, err)
+	}
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		run := &Run{Time: time.Now(), Results: []*backtrace.TargetResult{{IP: ip}}}
+		if err := Append(path, run); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runs, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 3 || runs[2].ID != 3 || runs[2].Results[0].IP != "192.0.2.3" {
+		t.Fatalf("unexpected runs %+v", runs)
+	}
+	for id, want := range map[int]int{1: 1, 3: 3, -1: 3, -3: 1} {
+		if run, err := Find(runs, id); err != nil || run.ID != want {
+			t.Errorf("Find(%d) = %v, %v", id, run, err)
+		}
+	}
+	for _, id := range []int{0, 4, -4} {
+		if _, err := Find(runs, id); err == nil {
+			t.Errorf("Find(%d) succeeded", id)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package vantage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// 提供者的默认地址
+const (
+	IPInfoURL            = "https://ipinfo.io/json"
+	IPAPIURL             = "http://ip-api.com/json/" // 免费接口只支持HTTP
+	CloudflareTraceURL   = "https://www.cloudflare.com/cdn-cgi/trace"
+	CloudflareIPTraceURL = "https://1.1.1.1/cdn-cgi/trace" // 无需解析域名，只能通过IPv4访问
+)
+
+// get 通过 network 请求 url 并返回响应内容
+func get(ctx context.Context, network, url string) ([]byte, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{}
+	transport.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	defer transport.CloseIdleConnections()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json, text/plain")
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+}
+
+// IPInfo ipinfo.io 的JSON接口
+type IPInfo struct {
+	URL string // 为空时使用 IPInfoURL
+}
+
+// Name 实现 Provider
+func (p *IPInfo) Name() string { return "ipinfo" }
+
+// Lookup 实现 Provider
+func (p *IPInfo) Lookup(ctx context.Context, network string) (*Info, error) {
+	url := p.URL
+	if url == "" {
+		url = IPInfoURL
+	}
+	body, err := get(ctx, network, url)
+	if err != nil {
+		return nil, err
+	}
+	var info Info
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &info, nil
+}
+
+// IPAPI ip-api.com 格式的JSON接口
+type IPAPI struct {
+	URL string // 为空时使用 IPAPIURL
+}
+
+// Name 实现 Provider
+func (p *IPAPI) Name() string { return "ip-api" }
+
+// Lookup 实现 Provider
+func (p *IPAPI) Lookup(ctx context.Context, network string) (*Info, error) {
+	url := p.URL
+	if url == "" {
+		url = IPAPIURL
+	}
+	body, err := get(ctx, network, url)
+	if err != nil {
+		return nil, err
+	}
+	var r struct {
+		Status      string   `json:"status"`
+		Message     string   `json:"message"`
+		Query       string   `json:"query"`
+		CountryCode string   `json:"countryCode"`
+		RegionName  string   `json:"regionName"`
+		City        string   `json:"city"`
+		Lat         *float64 `json:"lat"`
+		Lon         *float64 `json:"lon"`
+		ISP         string   `json:"isp"`
+		AS          string   `json:"as"` // 如 AS4134 CHINANET-BACKBONE
+	}
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	if r.Status != "" && r.Status != "success" {
+		return nil, fmt.Errorf("status %s: %s", r.Status, r.Message)
+	}
+	info := &Info{IP: r.Query, City: r.City, Region: r.RegionName, Country: r.CountryCode, Org: r.AS}
+	if info.Org == "" {
+		info.Org = r.ISP
+	}
+	if r.Lat != nil && r.Lon != nil {
+		info.Loc = fmt.Sprintf("%.4f,%.4f", *r.Lat, *r.Lon)
+	}
+	return info, nil
+}
+
+// Trace Cloudflare trace 格式的文本接口，每行为 key=value，ip 为地址，loc 为国家代码
+type Trace struct {
+	URL string // 为空时使用 CloudflareTraceURL
+}
+
+// Name 实现 Provider
+func (p *Trace) Name() string { return "trace" }
+
+// Lookup 实现 Provider
+func (p *Trace) Lookup(ctx context.Context, network string) (*Info, error) {
+	url := p.URL
+	if url == "" {
+		url = CloudflareTraceURL
+	}
+	body, err := get(ctx, network, url)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), "=")
+		switch key {
+		case "ip":
+			info.IP = value
+		case "loc":
+			// XX 表示未知
+			if value != "XX" {
+				info.Country = value
+			}
+		}
+	}
+	if info.IP == "" {
+		return nil, fmt.Errorf("no ip in response")
+	}
+	return info, nil
+}
+
+// EchoHandler 以 Trace 格式返回请求方的地址，类似STUN的地址反射，
+// 可部署在自己的服务器上作为 Trace 的地址，也用于离线测试
+func EchoHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "ip=%s\n", host)
+	})
+}
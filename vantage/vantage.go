@@ -0,0 +1,181 @@
+// Package vantage 查询本机（检测发起端）的公网地址及位置：并行向多个提供者查询，
+// 任一提供者失败或超时时使用其它提供者的结果，IPv4 和 IPv6 出口分别查询后合并
+package vantage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+)
+
+// DefaultTimeout 默认的查询超时时间
+const DefaultTimeout = 5 * time.Second
+
+// 查询使用的出口网络
+const (
+	NetworkAny  = "tcp"  // 由系统选择
+	NetworkIPv4 = "tcp4" // 只通过IPv4查询
+	NetworkIPv6 = "tcp6" // 只通过IPv6查询
+)
+
+// Info 本机的公网地址及位置，字段与 ipinfo.io 的JSON输出一致，各提供者只填写其支持的字段
+type Info struct {
+	IP      string   `json:"ip"`             // 首选的公网地址，同时具备IPv4和IPv6时为IPv4地址
+	IPv4    string   `json:"ipv4,omitempty"` // IPv4出口地址
+	IPv6    string   `json:"ipv6,omitempty"` // IPv6出口地址
+	City    string   `json:"city"`
+	Region  string   `json:"region"`
+	Country string   `json:"country"`       // ISO 3166-1 二字母国家代码
+	Org     string   `json:"org"`           // 如 AS4134 CHINANET-BACKBONE
+	Loc     string   `json:"loc,omitempty"` // 纬度,经度
+	Sources []string `json:"sources,omitempty"`
+}
+
+// Provider 本机公网信息的提供者
+type Provider interface {
+	// Name 返回提供者名称
+	Name() string
+	// Lookup 通过 network（NetworkAny、NetworkIPv4 或 NetworkIPv6）查询本机的公网信息
+	Lookup(ctx context.Context, network string) (*Info, error)
+}
+
+// DefaultProviders 返回默认的提供者：ipinfo.io、ip-api.com 及 Cloudflare trace
+func DefaultProviders() []Provider {
+	return []Provider{&IPInfo{}, &IPAPI{}, &Trace{}, &Trace{URL: CloudflareIPTraceURL}}
+}
+
+// AddressProviders 返回只查询地址、不查询位置的提供者，用于位置由离线数据库提供的情况
+func AddressProviders() []Provider {
+	return []Provider{&Trace{}, &Trace{URL: CloudflareIPTraceURL}}
+}
+
+// Detector 并行向所有提供者查询，返回合并后的结果
+type Detector struct {
+	Providers []Provider    // 为空时使用 DefaultProviders()
+	Timeout   time.Duration // 单次查询的超时时间，为0时使用 DefaultTimeout
+}
+
+// Lookup 并行向所有提供者查询 network 出口的信息，以最先返回的地址为准，
+// 并用地址一致的其它结果补全位置字段；字段齐全或所有提供者都已返回时结束
+func (d *Detector) Lookup(ctx context.Context, network string) (*Info, error) {
+	providers := d.Providers
+	if len(providers) == 0 {
+		providers = DefaultProviders()
+	}
+	timeout := d.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	type result struct {
+		name string
+		info *Info
+		err  error
+	}
+	// 带缓冲，提前结束后仍未返回的查询不会阻塞
+	c := make(chan result, len(providers))
+	for _, p := range providers {
+		go func(p Provider) {
+			info, err := p.Lookup(ctx, network)
+			if err == nil {
+				err = normalize(info, network)
+			}
+			c <- result{p.Name(), info, err}
+		}(p)
+	}
+	var merged *Info
+	var errs []error
+	for range providers {
+		r := <-c
+		switch {
+		case r.err != nil:
+			errs = append(errs, fmt.Errorf("%s: %w", r.name, r.err))
+			continue
+		case merged == nil:
+			merged = r.info
+		case merged.IP == r.info.IP:
+			merged.merge(r.info)
+		default:
+			// 不同提供者看到的出口地址不同（如多出口或代理），只采用首个结果
+			continue
+		}
+		merged.Sources = append(merged.Sources, r.name)
+		if merged.complete() {
+			break
+		}
+	}
+	if merged == nil {
+		return nil, fmt.Errorf("failed to get public IP info: %w", errors.Join(errs...))
+	}
+	return merged, nil
+}
+
+// Detect 分别通过IPv4和IPv6查询并合并结果，首选地址为IPv4地址，
+// 位置字段优先使用IPv4出口的结果；两者都失败时返回错误
+func (d *Detector) Detect(ctx context.Context) (*Info, error) {
+	var v4, v6 *Info
+	var err4, err6 error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		v6, err6 = d.Lookup(ctx, NetworkIPv6)
+	}()
+	v4, err4 = d.Lookup(ctx, NetworkIPv4)
+	<-done
+	switch {
+	case v4 != nil && v6 != nil:
+		v4.IPv6 = v6.IP
+		v4.merge(v6)
+		v4.Sources = append(v4.Sources, v6.Sources...)
+		return v4, nil
+	case v4 != nil:
+		return v4, nil
+	case v6 != nil:
+		return v6, nil
+	}
+	return nil, errors.Join(err4, err6)
+}
+
+// normalize 校验提供者返回的地址并按地址族填写 IPv4/IPv6 字段
+func normalize(info *Info, network string) error {
+	if info == nil {
+		return errors.New("empty response")
+	}
+	addr, err := netip.ParseAddr(info.IP)
+	if err != nil {
+		return fmt.Errorf("invalid IP address: %q", info.IP)
+	}
+	addr = addr.Unmap()
+	switch {
+	case network == NetworkIPv4 && !addr.Is4(), network == NetworkIPv6 && !addr.Is6():
+		return fmt.Errorf("%s is not reachable through %s", addr, network)
+	}
+	info.IP = addr.String()
+	info.IPv4, info.IPv6 = "", ""
+	if addr.Is4() {
+		info.IPv4 = info.IP
+	} else {
+		info.IPv6 = info.IP
+	}
+	info.Sources = nil
+	return nil
+}
+
+// merge 用 o 补全 i 中为空的位置字段
+func (i *Info) merge(o *Info) {
+	for _, f := range []struct{ dst, src *string }{
+		{&i.City, &o.City}, {&i.Region, &o.Region}, {&i.Country, &o.Country}, {&i.Org, &o.Org}, {&i.Loc, &o.Loc},
+	} {
+		if *f.dst == "" {
+			*f.dst = *f.src
+		}
+	}
+}
+
+// complete 返回是否已获得全部位置字段
+func (i *Info) complete() bool {
+	return i.City != "" && i.Region != "" && i.Country != "" && i.Org != "" && i.Loc != ""
+}
@@ -0,0 +1,139 @@
+package vantage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProviders(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ipinfo", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ip": "203.0.113.7", "hostname": "example", "city": "Guangzhou", "region": "Guangdong", "country": "CN", "loc": "23.1167,113.2500", "org": "AS4134 CHINANET-BACKBONE"}`))
+	})
+	mux.HandleFunc("/ip-api", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "success", "country": "China", "countryCode": "CN", "regionName": "Guangdong", "city": "Guangzhou", "lat": 23.1167, "lon": 113.25, "isp": "Chinanet", "as": "AS4134 CHINANET-BACKBONE", "query": "203.0.113.7"}`))
+	})
+	mux.HandleFunc("/ip-api-fail", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "fail", "message": "reserved range", "query": "127.0.0.1"}`))
+	})
+	mux.Handle("/echo", EchoHandler())
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	ctx := context.Background()
+	want := &Info{IP: "203.0.113.7", City: "Guangzhou", Region: "Guangdong", Country: "CN", Org: "AS4134 CHINANET-BACKBONE", Loc: "23.1167,113.2500"}
+	for _, p := range []Provider{&IPInfo{URL: srv.URL + "/ipinfo"}, &IPAPI{URL: srv.URL + "/ip-api"}} {
+		info, err := p.Lookup(ctx, NetworkIPv4)
+		if err != nil {
+			t.Fatalf("%s: %v", p.Name(), err)
+		}
+		if !reflect.DeepEqual(info, want) {
+			t.Errorf("%s = %+v, want %+v", p.Name(), info, want)
+		}
+	}
+	if _, err := (&IPAPI{URL: srv.URL + "/ip-api-fail"}).Lookup(ctx, NetworkIPv4); err == nil {
+		t.Error("failed ip-api status was accepted")
+	}
+	// 回显服务器返回请求方的地址
+	info, err := (&Trace{URL: srv.URL + "/echo"}).Lookup(ctx, NetworkIPv4)
+	if err != nil || info.IP != "127.0.0.1" {
+		t.Errorf("echo = %+v, %v", info, err)
+	}
+	if _, err := (&Trace{URL: srv.URL + "/missing"}).Lookup(ctx, NetworkIPv4); err == nil {
+		t.Error("HTTP 404 was accepted")
+	}
+}
+
+// stub 按地址族返回固定结果的提供者，delay 为0时立即返回，为负时阻塞到超时
+type stub struct {
+	name   string
+	v4, v6 *Info
+	delay  time.Duration
+}
+
+func (s *stub) Name() string { return s.name }
+
+func (s *stub) Lookup(ctx context.Context, network string) (*Info, error) {
+	if s.delay < 0 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	info := s.v4
+	if network == NetworkIPv6 {
+		info = s.v6
+	}
+	if info == nil {
+		return nil, errors.New("unreachable")
+	}
+	copied := *info
+	return &copied, nil
+}
+
+func TestDetectorLookup(t *testing.T) {
+	ctx := context.Background()
+	d := &Detector{Timeout: 200 * time.Millisecond, Providers: []Provider{
+		&stub{name: "trace", v4: &Info{IP: "203.0.113.7", Country: "CN"}},
+		&stub{name: "ipinfo", v4: &Info{IP: "203.0.113.7", City: "Guangzhou", Region: "Guangdong", Org: "AS4134 CHINANET-BACKBONE", Loc: "23.1,113.2"}, delay: 20 * time.Millisecond},
+		&stub{name: "proxy", v4: &Info{IP: "198.51.100.1", City: "Elsewhere"}, delay: 10 * time.Millisecond},
+		&stub{name: "broken"},
+		&stub{name: "hang", delay: -1},
+	}}
+	start := time.Now()
+	info, err := d.Lookup(ctx, NetworkIPv4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 字段齐全后不再等待阻塞的提供者
+	if elapsed := time.Since(start); elapsed >= d.Timeout {
+		t.Errorf("Lookup waited %v for a hanging provider", elapsed)
+	}
+	want := &Info{IP: "203.0.113.7", IPv4: "203.0.113.7", City: "Guangzhou", Region: "Guangdong", Country: "CN",
+		Org: "AS4134 CHINANET-BACKBONE", Loc: "23.1,113.2", Sources: []string{"trace", "ipinfo"}}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("Lookup = %+v, want %+v", info, want)
+	}
+
+	// 所有提供者都失败时在超时后返回错误
+	d.Providers = []Provider{&stub{name: "broken"}, &stub{name: "hang", delay: -1}}
+	if _, err := d.Lookup(ctx, NetworkIPv4); err == nil {
+		t.Error("Lookup without results did not fail")
+	}
+	// 地址族不符的结果被丢弃
+	d.Providers = []Provider{&stub{name: "wrong", v4: &Info{IP: "2001:db8::1"}}}
+	if _, err := d.Lookup(ctx, NetworkIPv4); err == nil {
+		t.Error("IPv6 address accepted for tcp4")
+	}
+}
+
+func TestDetect(t *testing.T) {
+	ctx := context.Background()
+	d := &Detector{Timeout: 100 * time.Millisecond, Providers: []Provider{
+		&stub{name: "trace", v4: &Info{IP: "203.0.113.7", Country: "CN"}, v6: &Info{IP: "2001:db8::7", Country: "CN"}},
+		&stub{name: "ipinfo", v6: &Info{IP: "2001:db8::7", City: "Guangzhou"}},
+	}}
+	info, err := d.Detect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.IP != "203.0.113.7" || info.IPv4 != "203.0.113.7" || info.IPv6 != "2001:db8::7" || info.City != "Guangzhou" || info.Country != "CN" {
+		t.Errorf("Detect = %+v", info)
+	}
+	// 只有IPv6出口
+	d.Providers = []Provider{&stub{name: "trace", v6: &Info{IP: "2001:db8::7"}}}
+	if info, err := d.Detect(ctx); err != nil || info.IP != "2001:db8::7" || info.IPv4 != "" {
+		t.Errorf("IPv6 only: %+v, %v", info, err)
+	}
+	d.Providers = []Provider{&stub{name: "broken"}}
+	if _, err := d.Detect(ctx); err == nil {
+		t.Error("Detect without results did not fail")
+	}
+}